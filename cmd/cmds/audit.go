@@ -0,0 +1,94 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	auditUser   string
+	auditMac    string
+	auditNas    string
+	auditResult string
+	auditSource string
+	auditSince  string
+	auditOffset int
+	auditLimit  int
+)
+
+func init() {
+	auditCmd.Flags().StringVarP(&auditUser, "user", "u", "", "only entries of this user")
+	auditCmd.Flags().StringVarP(&auditMac, "mac", "m", "", "only entries of this MAC address")
+	auditCmd.Flags().StringVarP(&auditNas, "nas", "n", "", "only entries of this NAS")
+	auditCmd.Flags().StringVarP(&auditResult, "result", "r", "", "only accept or reject entries")
+	auditCmd.Flags().StringVarP(&auditSource, "source", "s", "", "only entries decided from this source (authenticator, cache, offline, negative_cache, fallback, freeradius)")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "only entries since this duration or RFC 3339 date")
+	auditCmd.Flags().IntVar(&auditOffset, "offset", 0, "skip this number of entries")
+	auditCmd.Flags().IntVar(&auditLimit, "limit", 100, "show at most this number of entries")
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the latest authentication decisions, the most recent first",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		request := getApiClient(cfg).R().
+			SetQueryParam("offset", strconv.Itoa(auditOffset)).
+			SetQueryParam("limit", strconv.Itoa(auditLimit))
+		for name, value := range map[string]string{
+			"username": auditUser,
+			"mac":      auditMac,
+			"nas":      auditNas,
+			"result":   auditResult,
+			"source":   auditSource,
+			"since":    auditSince,
+		} {
+			if len(value) > 0 {
+				request.SetQueryParam(name, value)
+			}
+		}
+		resp, err := request.Get("/api/v1/audit")
+		if err != nil {
+			printError(err)
+			return
+		}
+		if resp.StatusCode() != http.StatusOK {
+			printError(getApiError("list audit entries", resp))
+			return
+		}
+		list := binding.AuditList{}
+		if err := json.Unmarshal(resp.Body(), &list); err != nil {
+			printError(err)
+			return
+		}
+		if asJSON {
+			printJSON(list)
+		} else {
+			printAudit(list)
+		}
+	},
+}
+
+func printAudit(list binding.AuditList) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tUSERNAME\tMAC\tNAS\tSSID\tVLAN\tRESULT\tSOURCE\tREASON")
+	for _, entry := range list.Entries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.Username, entry.Mac, entry.Nas, entry.Ssid,
+			entry.VLAN, entry.Result, entry.Source, entry.Reason)
+	}
+	_ = w.Flush()
+	fmt.Printf("\n%d of %d entries\n", len(list.Entries), list.Total)
+}
@@ -0,0 +1,122 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	cacheCmd.AddCommand(cacheListCmd, cacheEvictCmd, cacheFlushCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the user cache",
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached users",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		resp, err := getApiClient(cfg).R().Get("/api/v1/cache/users")
+		if err != nil {
+			printError(err)
+			return
+		}
+		if resp.StatusCode() != 200 {
+			printError(getApiError("list cache entries", resp))
+			return
+		}
+		var entries []binding.CacheEntry
+		if err := json.Unmarshal(resp.Body(), &entries); err != nil {
+			printError(err)
+			return
+		}
+		if asJSON {
+			printJSON(entries)
+		} else {
+			printCacheEntries(entries)
+		}
+	},
+}
+
+var cacheEvictCmd = &cobra.Command{
+	Use:   "evict USERNAME [MAC]",
+	Short: "Evict a user/MAC pair, or every entry of a user, from the cache",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		request := getApiClient(cfg).R().SetQueryParam("username", args[0])
+		if len(args) == 2 {
+			request.SetQueryParam("mac", args[1])
+		}
+		resp, err := request.Delete("/api/v1/cache/users")
+		if err != nil {
+			printError(err)
+			return
+		}
+		printEvictResponse("evict cache entries", resp)
+	},
+}
+
+var cacheFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Remove every entry from the cache",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		resp, err := getApiClient(cfg).R().Delete("/api/v1/cache")
+		if err != nil {
+			printError(err)
+			return
+		}
+		printEvictResponse("flush cache", resp)
+	},
+}
+
+func printEvictResponse(action string, resp *resty.Response) {
+	if resp.StatusCode() != 200 {
+		printError(getApiError(action, resp))
+		return
+	}
+	response := binding.CacheEvictResponse{}
+	if err := json.Unmarshal(resp.Body(), &response); err != nil {
+		printError(fmt.Errorf("cannot %s: %w", action, err))
+		return
+	}
+	if asJSON {
+		printJSON(response)
+	} else {
+		fmt.Printf("%d entries evicted\n", response.Evicted)
+	}
+}
+
+func printCacheEntries(entries []binding.CacheEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USERNAME\tMAC\tVLAN\tROLE\tAGE\tPASSWORD")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", entry.Username, entry.Mac, entry.VLAN, entry.Role, time.Duration(entry.Age)*time.Second, entry.Password)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,95 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"text/tabwriter"
+)
+
+var (
+	kickUser string
+	kickMac  string
+	kickCoA  bool
+)
+
+func init() {
+	kickCmd.Flags().StringVarP(&kickUser, "user", "u", "", "kick the active sessions of this user")
+	kickCmd.Flags().StringVarP(&kickMac, "mac", "m", "", "kick the active sessions of this MAC address")
+	kickCmd.Flags().BoolVar(&kickCoA, "coa", false, "send a CoA with the cached authorization instead of a disconnect")
+	rootCmd.AddCommand(kickCmd)
+}
+
+var kickCmd = &cobra.Command{
+	Use:   "kick [SESSION_ID]",
+	Short: "Disconnect active sessions, or reauthorize them with --coa",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		request := binding.KickRequest{
+			Username: kickUser,
+			Mac:      kickMac,
+			Action:   binding.DisconnectAction,
+		}
+		if len(args) > 0 {
+			request.SessionId = args[0]
+		}
+		if kickCoA {
+			request.Action = binding.CoAAction
+		}
+		if len(request.SessionId) == 0 && len(request.Username) == 0 && len(request.Mac) == 0 {
+			printError(errors.New("a session ID, --user or --mac is mandatory"))
+			return
+		}
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		resp, err := getApiClient(cfg).R().SetBody(request).Post("/api/v1/kick")
+		if err != nil {
+			printError(err)
+			return
+		}
+		switch resp.StatusCode() {
+		case http.StatusOK:
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable:
+			answer := map[string]string{}
+			if err := json.Unmarshal(resp.Body(), &answer); err == nil && len(answer["message"]) > 0 {
+				printError(fmt.Errorf("cannot kick sessions: %s", answer["message"]))
+				return
+			}
+			printError(getApiError("kick sessions", resp))
+			return
+		default:
+			printError(getApiError("kick sessions", resp))
+			return
+		}
+		response := binding.KickResponse{}
+		if err := json.Unmarshal(resp.Body(), &response); err != nil {
+			printError(err)
+			return
+		}
+		if asJSON {
+			printJSON(response)
+		} else {
+			printKickResponse(response)
+		}
+	},
+}
+
+func printKickResponse(response binding.KickResponse) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tUSERNAME\tMAC\tNAS\tRESULT")
+	for _, result := range response.Results {
+		status := "acknowledged"
+		if !result.Acknowledged {
+			status = "failed: " + result.Error
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.SessionId, result.Username, result.Mac, result.Nas, status)
+	}
+	_ = w.Flush()
+}
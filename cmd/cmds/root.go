@@ -6,7 +6,9 @@ import (
 	"github.com/COSAE-FR/ripradius/pkg/utils"
 	"github.com/COSAE-FR/ripradius/svc/daemon"
 	"github.com/COSAE-FR/riputils/svc"
+	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
+	"net/http"
 	"os"
 )
 
@@ -60,3 +62,21 @@ func printError(err error) {
 func getDaemonConfig() (*daemon.Configuration, error) {
 	return daemon.NewConfiguration(cfgFile)
 }
+
+func getApiClient(cfg *daemon.Configuration) *resty.Client {
+	if err := cfg.Api.TokenError(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+	client := resty.New()
+	client.SetBaseURL(fmt.Sprintf("http://%s:%d", cfg.Api.IPAddress, cfg.Api.Port))
+	client.SetHeader("Accept", "application/json")
+	client.SetAuthToken(cfg.Api.Token)
+	return client
+}
+
+func getApiError(action string, resp *resty.Response) error {
+	if resp.StatusCode() == http.StatusUnauthorized {
+		return fmt.Errorf("cannot %s: unauthorized, the API token must be set in the configuration file or readable in the API token file", action)
+	}
+	return fmt.Errorf("cannot %s: %s (%d)", action, resp.Status(), resp.StatusCode())
+}
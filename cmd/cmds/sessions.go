@@ -0,0 +1,155 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/spf13/cobra"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	sessionUser   string
+	sessionMac    string
+	sessionNas    string
+	sessionVlan   uint16
+	sessionAll    bool
+	sessionOffset int
+	sessionLimit  int
+)
+
+func init() {
+	sessionsListCmd.Flags().StringVarP(&sessionUser, "user", "u", "", "only sessions of this user")
+	sessionsListCmd.Flags().StringVarP(&sessionMac, "mac", "m", "", "only sessions of this MAC address")
+	sessionsListCmd.Flags().StringVarP(&sessionNas, "nas", "n", "", "only sessions on this NAS")
+	sessionsListCmd.Flags().Uint16VarP(&sessionVlan, "vlan", "v", 0, "only sessions in this VLAN")
+	sessionsListCmd.Flags().BoolVarP(&sessionAll, "all", "a", false, "include stopped sessions")
+	sessionsListCmd.Flags().IntVar(&sessionOffset, "offset", 0, "skip this number of sessions")
+	sessionsListCmd.Flags().IntVar(&sessionLimit, "limit", 100, "show at most this number of sessions")
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Show the sessions known from accounting",
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sessions, the most recently updated first",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		request := getApiClient(cfg).R().
+			SetQueryParam("offset", strconv.Itoa(sessionOffset)).
+			SetQueryParam("limit", strconv.Itoa(sessionLimit))
+		if !sessionAll {
+			request.SetQueryParam("active", "true")
+		}
+		if len(sessionUser) > 0 {
+			request.SetQueryParam("username", sessionUser)
+		}
+		if len(sessionMac) > 0 {
+			request.SetQueryParam("mac", sessionMac)
+		}
+		if len(sessionNas) > 0 {
+			request.SetQueryParam("nas", sessionNas)
+		}
+		if sessionVlan > 0 {
+			request.SetQueryParam("vlan", strconv.Itoa(int(sessionVlan)))
+		}
+		resp, err := request.Get("/api/v1/sessions")
+		if err != nil {
+			printError(err)
+			return
+		}
+		if resp.StatusCode() != http.StatusOK {
+			printError(getApiError("list sessions", resp))
+			return
+		}
+		list := binding.SessionList{}
+		if err := json.Unmarshal(resp.Body(), &list); err != nil {
+			printError(err)
+			return
+		}
+		if asJSON {
+			printJSON(list)
+		} else {
+			printSessions(list)
+		}
+	},
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show SESSION_ID",
+	Short: "Show a session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		resp, err := getApiClient(cfg).R().Get("/api/v1/sessions/" + url.PathEscape(args[0]))
+		if err != nil {
+			printError(err)
+			return
+		}
+		if resp.StatusCode() == http.StatusNotFound {
+			printError(fmt.Errorf("session %s not found", args[0]))
+			return
+		}
+		if resp.StatusCode() != http.StatusOK {
+			printError(getApiError("show session", resp))
+			return
+		}
+		found := session.Session{}
+		if err := json.Unmarshal(resp.Body(), &found); err != nil {
+			printError(err)
+			return
+		}
+		if asJSON {
+			printJSON(found)
+		} else {
+			printSession(found)
+		}
+	},
+}
+
+func sessionState(found session.Session) string {
+	if found.Active() {
+		return "active"
+	}
+	return "stopped"
+}
+
+func printSessions(list binding.SessionList) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tUSERNAME\tMAC\tNAS\tPORT\tVLAN\tIP\tDURATION\tIN\tOUT\tSTATE")
+	for _, found := range list.Sessions {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%d\t%d\t%s\n", found.ID, found.Username, found.Mac, found.Nas, found.NasPort, found.VLAN, found.FramedIP,
+			time.Duration(found.Duration)*time.Second, found.InputBytes, found.OutputBytes, sessionState(found))
+	}
+	_ = w.Flush()
+	fmt.Printf("\n%d of %d sessions\n", len(list.Sessions), list.Total)
+}
+
+func printSession(found session.Session) {
+	fmt.Printf("# Session %s\n\n   - User: %s\n   - MAC: %s\n   - NAS: %s\n   - NAS port: %s\n   - VLAN: %d\n   - IP: %s\n   - Started: %s\n   - Updated: %s\n   - Duration: %s\n   - Input bytes: %d\n   - Output bytes: %d\n   - State: %s\n",
+		found.ID, found.Username, found.Mac, found.Nas, found.NasPort, found.VLAN, found.FramedIP, found.Started.Format(time.RFC3339), found.Updated.Format(time.RFC3339),
+		time.Duration(found.Duration)*time.Second, found.InputBytes, found.OutputBytes, sessionState(found))
+	if found.Stopped != nil {
+		fmt.Printf("   - Stopped: %s (%s)\n", found.Stopped.Format(time.RFC3339), found.TerminateCause)
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/COSAE-FR/ripradius/pkg/api/binding"
 	"github.com/COSAE-FR/ripradius/pkg/utils"
-	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 func init() {
@@ -22,9 +22,7 @@ var statusCmd = &cobra.Command{
 			printError(err)
 			return
 		}
-		client := resty.New()
-		client.SetBaseURL(fmt.Sprintf("http://%s:%d", cfg.Api.IPAddress, cfg.Api.Port))
-		resp, err := client.R().SetHeader("Accept", "application/json").Get("/api/v1/status")
+		resp, err := getApiClient(cfg).R().Get("/api/v1/status")
 		if err != nil {
 			printError(err)
 			return
@@ -50,6 +48,26 @@ var statusCmd = &cobra.Command{
 }
 
 func printStatus(status binding.ServerStatus) {
-	fmt.Printf("# %s statistics\n\n## Cache\n\n   - Misses: %d\n   - Hits: %d\n   - Added: %d\n   - Evicted: %d\n   - Entries: %d\n   - Offline: %v\n",
-		utils.Name, status.Cache.Misses, status.Cache.Hits, status.Cache.Added, status.Cache.Evicted, status.Cache.Entries, status.Cache.Offline)
+	fmt.Printf("# %s statistics\n\n## Cache\n\n   - Misses: %d\n   - Hits: %d\n   - Added: %d\n   - Evicted: %d\n   - Entries: %d\n   - Devices: %d\n   - Clients: %d\n   - Admins: %d\n   - Offline: %v\n\n## Negative cache\n\n   - Misses: %d\n   - Hits: %d\n   - Entries: %d\n\n## Requests\n\n   - Coalesced: %d\n",
+		utils.Name, status.Cache.Misses, status.Cache.Hits, status.Cache.Added, status.Cache.Evicted, status.Cache.Entries, status.Cache.Devices, status.Cache.Clients, status.Cache.Admins, status.Cache.Offline,
+		status.Cache.NegativeMisses, status.Cache.NegativeHits, status.Cache.NegativeEntries,
+		status.Requests.Coalesced)
+	fmt.Printf("\n## Sessions\n\n   - Active: %d\n   - Total: %d\n   - Pending records: %d\n   - Dropped records: %d\n",
+		status.Sessions.Active, status.Sessions.Total, status.Sessions.Pending, status.Sessions.Dropped)
+	fmt.Printf("\n## Upstream\n\n   - State: %s (since %s)\n   - Strategy: %s\n   - Active: %s\n",
+		status.Health.State, status.Health.Since.Format(time.RFC3339), status.Upstream.Strategy, status.Upstream.Active)
+	for _, server := range status.Upstream.Servers {
+		fmt.Printf("   - %s: available: %v, failures: %d", server.URL, server.Available, server.Failures)
+		if len(server.LastError) > 0 {
+			fmt.Printf(", last error: %s", server.LastError)
+		}
+		fmt.Println()
+	}
+	if status.Certificate != nil {
+		fmt.Printf("\n## Certificate\n\n   - Subject: %s\n   - Issuer: %s\n   - Expires: %s\n   - Expiring soon: %v\n",
+			status.Certificate.Subject, status.Certificate.Issuer, status.Certificate.NotAfter.Format(time.RFC3339), status.Certificate.ExpiringSoon)
+		for _, warning := range status.Certificate.Warnings {
+			fmt.Printf("   - Warning: %s\n", warning)
+		}
+	}
 }
@@ -0,0 +1,125 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"github.com/spf13/cobra"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	tailUser  string
+	tailMac   string
+	tailNas   string
+	tailTypes []string
+)
+
+func init() {
+	tailCmd.Flags().StringVarP(&tailUser, "user", "u", "", "only events of this user")
+	tailCmd.Flags().StringVarP(&tailMac, "mac", "m", "", "only events of this MAC address")
+	tailCmd.Flags().StringVarP(&tailNas, "nas", "n", "", "only events of this NAS")
+	tailCmd.Flags().StringSliceVarP(&tailTypes, "type", "t", nil, "only events of these types (authorize, cache, upstream, post-auth)")
+	rootCmd.AddCommand(tailCmd)
+}
+
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Follow the authentication events in real time",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := getDaemonConfig()
+		if err != nil {
+			printError(err)
+			return
+		}
+		request := getApiClient(cfg).R().
+			SetDoNotParseResponse(true).
+			SetHeader("Accept", "text/event-stream")
+		for name, value := range map[string]string{
+			"username": tailUser,
+			"mac":      tailMac,
+			"nas":      tailNas,
+			"type":     strings.Join(tailTypes, ","),
+		} {
+			if len(value) > 0 {
+				request.SetQueryParam(name, value)
+			}
+		}
+		resp, err := request.Get("/api/v1/events")
+		if err != nil {
+			printError(err)
+			return
+		}
+		body := resp.RawBody()
+		defer func() {
+			_ = body.Close()
+		}()
+		if resp.StatusCode() != http.StatusOK {
+			printError(getApiError("follow events", resp))
+			return
+		}
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		var data strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "data:"):
+				data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			case len(line) == 0 && data.Len() > 0:
+				printEvent(data.String())
+				data.Reset()
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			printError(err)
+			return
+		}
+		printError(fmt.Errorf("event stream closed by the server"))
+	},
+}
+
+func printEvent(data string) {
+	if asJSON {
+		fmt.Println(data)
+		return
+	}
+	event := events.Event{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		printError(err)
+		return
+	}
+	subject := make([]string, 0, 3)
+	for _, value := range []string{event.Username, event.Mac, event.Nas} {
+		if len(value) > 0 {
+			subject = append(subject, value)
+		}
+	}
+	fmt.Printf("%s [%s]", event.Time.Local().Format(time.RFC3339), event.Type)
+	if len(subject) > 0 {
+		fmt.Printf(" %s", strings.Join(subject, " "))
+	}
+	fmt.Printf(": %s", event.Message)
+	if len(event.Data) > 0 {
+		keys := make([]string, 0, len(event.Data))
+		for key := range event.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		details := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if value := fmt.Sprint(event.Data[key]); len(value) > 0 && value != "0" {
+				details = append(details, fmt.Sprintf("%s=%s", key, value))
+			}
+		}
+		if len(details) > 0 {
+			fmt.Printf(" (%s)", strings.Join(details, " "))
+		}
+	}
+	fmt.Println()
+}
@@ -14,6 +14,7 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/crypto v0.28.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -54,6 +55,5 @@ require (
 	gopkg.in/hlandau/easyconfig.v1 v1.0.18 // indirect
 	gopkg.in/hlandau/service.v2 v2.0.17 // indirect
 	gopkg.in/hlandau/svcutils.v1 v1.0.11 // indirect
-	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,21 +1,52 @@
 package binding
 
 import (
+	"encoding/json"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
 	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"strings"
+	"time"
 )
 
+// AdminVirtualServer is the Freeradius virtual server handling management logins
+const AdminVirtualServer = "rip"
+
+// PskVirtualServer is the Freeradius virtual server handling per-device PSK authorizations
+const PskVirtualServer = "psk"
+
+// MabVirtualServer is the Freeradius virtual server handling MAC authentication bypass
+const MabVirtualServer = "mab"
+
 type UserRequest struct {
 	Username      string `json:"username" binding:"required"`
 	Password      string `json:"password"`
 	ClientIp      string `json:"ip" binding:"required"`
+	NasIp         string `json:"nas_ip,omitempty"`
 	VirtualServer string `json:"realm" binding:"required"`
 	AuthType      string `json:"type"`
 	Authenticator string `json:"called"`
 	ClientMac     string `json:"calling"`
+	// Set when the client MAC address cannot be parsed, never sent to the authenticator
+	MacMalformed bool `json:"-"`
 }
 
+// GetClientMac returns the client MAC address in the canonical format, or as received if it cannot be parsed
 func (r UserRequest) GetClientMac() string {
+	mac, _ := radius.CanonicalMAC(r.rawClientMac())
+	return mac
+}
+
+// GetNas returns the NAS-IP-Address, or the packet source when missing, like PostAuthRequest.GetNas
+func (r UserRequest) GetNas() string {
+	if r.NasIp != "" {
+		return r.NasIp
+	}
+	return r.ClientIp
+}
+
+func (r UserRequest) rawClientMac() string {
 	if r.ClientMac != "" {
 		return r.ClientMac
 	}
@@ -26,22 +57,309 @@ func (r UserRequest) GetClientMac() string {
 	return ""
 }
 
+// GetSsid returns the SSID from the Called-Station-Id, empty on wired networks
+func (r UserRequest) GetSsid() string {
+	parts := strings.Split(r.Authenticator, ":")
+	if len(parts) >= 2 {
+		return parts[len(parts)-1]
+	}
+	return ""
+}
+
+// Normalize converts the client MAC address to the canonical format and flags the request if it is malformed
+func (r *UserRequest) Normalize() {
+	raw := r.rawClientMac()
+	if raw == "" {
+		return
+	}
+	mac, valid := radius.CanonicalMAC(raw)
+	r.MacMalformed = !valid
+	if r.ClientMac != "" && valid {
+		r.ClientMac = mac
+	}
+}
+
 type RadiusUserResponse struct {
 	TunnelType   string `json:"reply:Tunnel-Type" default:"VLAN"`
 	TunnelMedium string `json:"reply:Tunnel-Medium-Type" default:"IEEE-802"`
 	VLAN         uint16 `json:"reply:Tunnel-Private-Group-Id" default:"0"`
 	Password     string `json:"config:Password-With-Header" binding:"required"`
+	// Role decided by the authenticator, translated to attributes by the vendor profiles
+	Role string `json:"-"`
+	// Other reply attributes, added as reply:Name entries replacing the fields above
+	Attributes radius.Attributes `json:"-"`
+}
+
+// MarshalJSON returns the response in the Freeradius rest module format
+func (r RadiusUserResponse) MarshalJSON() ([]byte, error) {
+	type plain RadiusUserResponse
+	return marshalWithAttributes(plain(r), r.Attributes)
+}
+
+// marshalWithAttributes encodes a response, adding the attributes as reply:Name entries
+func marshalWithAttributes(response interface{}, attributes radius.Attributes) ([]byte, error) {
+	content, err := json.Marshal(response)
+	if err != nil || len(attributes) == 0 {
+		return content, err
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(content, &values); err != nil {
+		return nil, err
+	}
+	for key, value := range attributes.Reply() {
+		values[key] = value
+	}
+	return json.Marshal(values)
+}
+
+// RadiusDeviceResponse accepts a device authenticated by its MAC address, with its PSK in the attributes
+type RadiusDeviceResponse struct {
+	AuthType     string `json:"control:Auth-Type" default:"Accept"`
+	TunnelType   string `json:"reply:Tunnel-Type" default:"VLAN"`
+	TunnelMedium string `json:"reply:Tunnel-Medium-Type" default:"IEEE-802"`
+	VLAN         uint16 `json:"reply:Tunnel-Private-Group-Id" default:"0"`
+	// PSK and other reply attributes, added as reply:Name entries replacing the fields above
+	Attributes radius.Attributes `json:"-"`
+}
+
+// MarshalJSON returns the response in the Freeradius rest module format
+func (r RadiusDeviceResponse) MarshalJSON() ([]byte, error) {
+	type plain RadiusDeviceResponse
+	return marshalWithAttributes(plain(r), r.Attributes)
+}
+
+// UpstreamDeviceResponse is the authenticator answer to a device (PSK) authorization
+type UpstreamDeviceResponse struct {
+	Psk        string            `json:"psk"`
+	VLAN       uint16            `json:"vlan"`
+	Role       string            `json:"role"`
+	Attributes radius.Attributes `json:"attributes"`
+}
+
+// UpstreamUserResponse is the authenticator answer to a user authorization with API version 2
+type UpstreamUserResponse struct {
+	Password   string            `json:"password"`
+	VLAN       uint16            `json:"vlan"`
+	Role       string            `json:"role"`
+	Attributes radius.Attributes `json:"attributes"`
+}
+
+// UpstreamAdminResponse is the authenticator answer to a management login
+type UpstreamAdminResponse struct {
+	Password string `json:"config:Password-With-Header"`
+	Class    string `json:"reply:Class"`
+	// Privilege attributes, like Service-Type or Cisco-AVPair shell:priv-lvl
+	Attributes radius.Attributes `json:"attributes"`
 }
 
 type RadiusAdminResponse struct {
 	Password string `json:"config:Password-With-Header" binding:"required"`
-	Class    string `json:"reply:Class"`
+	// Class and privilege attributes, added as reply:Name entries
+	Attributes radius.Attributes `json:"-"`
+}
+
+// MarshalJSON returns the response in the Freeradius rest module format
+func (r RadiusAdminResponse) MarshalJSON() ([]byte, error) {
+	type plain RadiusAdminResponse
+	return marshalWithAttributes(plain(r), r.Attributes)
 }
 
 type RadiusRejectResponse struct {
 	AuthType string `json:"control:Auth-Type" default:"Reject"`
 }
 
+type DynamicClient struct {
+	// Defaults to the client IP address
+	Shortname string `json:"shortname"`
+	Secret    string `json:"secret"`
+	// Freeradius virtual server of the client, defaults to AdminVirtualServer
+	Server string `json:"server"`
+}
+
+// CacheEntry is a cached user, as shown by the cache administration API
+type CacheEntry struct {
+	Username string    `json:"username"`
+	Mac      string    `json:"mac"`
+	VLAN     uint16    `json:"vlan"`
+	Created  time.Time `json:"created"`
+	// Age in seconds
+	Age        int64             `json:"age"`
+	Password   string            `json:"password"`
+	Role       string            `json:"role,omitempty"`
+	Attributes radius.Attributes `json:"attributes,omitempty"`
+}
+
+type CacheEvictResponse struct {
+	Evicted int `json:"evicted"`
+}
+
+// RequestStatus provides statistics for authorize requests
+type RequestStatus struct {
+	// Requests answered with a concurrent request upstream lookup
+	Coalesced int `json:"coalesced"`
+}
+
+// UpstreamServerStatus provides the health of an authenticator server
+type UpstreamServerStatus struct {
+	URL         string     `json:"url"`
+	Available   bool       `json:"available"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// UpstreamStatus provides the health of the authenticator servers
+type UpstreamStatus struct {
+	Strategy string                 `json:"strategy"`
+	Active   string                 `json:"active"`
+	Servers  []UpstreamServerStatus `json:"servers"`
+}
+
+// HealthStatus provides the upstream authenticator state
+type HealthStatus struct {
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// CertificateStatus provides the Freeradius server certificate validity
+type CertificateStatus struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	// Seconds before expiration
+	ExpiresIn    int64    `json:"expires_in"`
+	ExpiringSoon bool     `json:"expiring_soon"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
 type ServerStatus struct {
-	Cache cache.Status `json:"cache"`
+	Cache       cache.Status       `json:"cache"`
+	Sessions    session.Status     `json:"sessions"`
+	Requests    RequestStatus      `json:"requests"`
+	Upstream    UpstreamStatus     `json:"upstream"`
+	Health      HealthStatus       `json:"health"`
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+}
+
+// SessionList is a page of the session table
+type SessionList struct {
+	Total    int               `json:"total"`
+	Offset   int               `json:"offset"`
+	Limit    int               `json:"limit"`
+	Sessions []session.Session `json:"sessions"`
+}
+
+// Dynamic authorization actions
+const (
+	DisconnectAction = "disconnect"
+	CoAAction        = "coa"
+)
+
+// KickRequest selects the active sessions to disconnect, or to reauthorize with the cached user authorization
+type KickRequest struct {
+	SessionId string `json:"session_id"`
+	Username  string `json:"username"`
+	Mac       string `json:"mac"`
+	Action    string `json:"action" default:"disconnect" binding:"omitempty,oneof=disconnect coa"`
+}
+
+// KickResult is the NAS answer for a session
+type KickResult struct {
+	SessionId    string `json:"session_id"`
+	Username     string `json:"username"`
+	Mac          string `json:"mac"`
+	Nas          string `json:"nas"`
+	Acknowledged bool   `json:"acknowledged"`
+	Error        string `json:"error,omitempty"`
+}
+
+// KickResponse lists the results of a kick request
+type KickResponse struct {
+	Action  string       `json:"action"`
+	Results []KickResult `json:"results"`
+}
+
+// PostAuthRequest is the Freeradius outcome of an authentication, sent by the rest module in post-auth
+type PostAuthRequest struct {
+	Result        string `json:"result" binding:"required,oneof=accept reject"`
+	Username      string `json:"username"`
+	ClientIp      string `json:"ip" binding:"required"`
+	NasIp         string `json:"nas_ip"`
+	VirtualServer string `json:"realm"`
+	Authenticator string `json:"called"`
+	ClientMac     string `json:"calling"`
+	VLAN          string `json:"vlan"`
+	Reason        string `json:"reason"`
+}
+
+// GetNas returns the NAS-IP-Address, or the packet source when missing
+func (r PostAuthRequest) GetNas() string {
+	if r.NasIp != "" {
+		return r.NasIp
+	}
+	return r.ClientIp
+}
+
+// GetClientMac returns the client MAC address, like UserRequest.GetClientMac
+func (r PostAuthRequest) GetClientMac() string {
+	return UserRequest{Authenticator: r.Authenticator, ClientMac: r.ClientMac}.GetClientMac()
+}
+
+// GetSsid returns the SSID, like UserRequest.GetSsid
+func (r PostAuthRequest) GetSsid() string {
+	return UserRequest{Authenticator: r.Authenticator}.GetSsid()
+}
+
+// AuditList is a page of the latest audit entries
+type AuditList struct {
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// AccountingRequest is an accounting record sent by the Freeradius rest module
+type AccountingRequest struct {
+	Status          string `json:"status" binding:"required"`
+	SessionId       string `json:"session_id"`
+	Username        string `json:"username"`
+	ClientIp        string `json:"ip" binding:"required"`
+	NasIp           string `json:"nas_ip"`
+	NasPort         string `json:"nas_port"`
+	Authenticator   string `json:"called"`
+	ClientMac       string `json:"calling"`
+	FramedIp        string `json:"framed_ip"`
+	VLAN            string `json:"vlan"`
+	SessionTime     uint32 `json:"session_time"`
+	InputOctets     uint32 `json:"input_octets"`
+	OutputOctets    uint32 `json:"output_octets"`
+	InputGigawords  uint32 `json:"input_gigawords"`
+	OutputGigawords uint32 `json:"output_gigawords"`
+	TerminateCause  string `json:"terminate_cause"`
+}
+
+// GetNas returns the NAS-IP-Address, or the packet source when missing
+func (r AccountingRequest) GetNas() string {
+	if r.NasIp != "" {
+		return r.NasIp
+	}
+	return r.ClientIp
+}
+
+// GetClientMac returns the client MAC address, like UserRequest.GetClientMac
+func (r AccountingRequest) GetClientMac() string {
+	return UserRequest{Authenticator: r.Authenticator, ClientMac: r.ClientMac}.GetClientMac()
+}
+
+// InputBytes returns the octets received from the user, with the gigawords
+func (r AccountingRequest) InputBytes() uint64 {
+	return uint64(r.InputGigawords)<<32 + uint64(r.InputOctets)
+}
+
+// OutputBytes returns the octets sent to the user, with the gigawords
+func (r AccountingRequest) OutputBytes() uint64 {
+	return uint64(r.OutputGigawords)<<32 + uint64(r.OutputOctets)
 }
@@ -0,0 +1,56 @@
+package binding
+
+import (
+	"encoding/json"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"reflect"
+	"testing"
+)
+
+func TestRadiusAdminResponseMarshal(t *testing.T) {
+	response := RadiusAdminResponse{
+		Password: "{ssha}secret",
+		Attributes: radius.Attributes{
+			{Name: "Class", Value: "%{exec:/bin/sh}"},
+			{Name: "Service-Type", Value: "6"},
+			{Name: "Cisco-AVPair", Value: "shell:priv-lvl=15"},
+		},
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"config:Password-With-Header": "{ssha}secret",
+		"reply:Class":                 map[string]interface{}{"value": []interface{}{"%{exec:/bin/sh}"}, "do_xlat": false},
+		"reply:Service-Type":          map[string]interface{}{"value": []interface{}{"6"}, "do_xlat": false},
+		"reply:Cisco-AVPair":          map[string]interface{}{"value": []interface{}{"shell:priv-lvl=15"}, "do_xlat": false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %s, want %v", content, want)
+	}
+}
+
+func TestUserRequestMalformedMac(t *testing.T) {
+	request := UserRequest{Username: "alice", ClientMac: "not-a-mac"}
+	request.Normalize()
+	if !request.MacMalformed {
+		t.Fatal("malformed MAC address not flagged")
+	}
+	content, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	// The flag is local, never sent to the authenticator
+	if _, found := got["mac_malformed"]; found {
+		t.Fatalf("malformed flag sent in %s", content)
+	}
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// RadiusDynamicClient answers a Freeradius rest xlat with the requested client field.
+// Without field, the client shortname is returned so the answer can be used as a condition.
+func RadiusDynamicClient(c *gin.Context, client binding.DynamicClient, field string, logger *logrus.Entry) {
+	var value string
+	switch field {
+	case "", "shortname":
+		value = client.Shortname
+	case "secret":
+		value = client.Secret
+	case "server":
+		value = client.Server
+	default:
+		logger.Errorf("Unknown dynamic client field requested: %s", field)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	logger.Tracef("Returning dynamic client %s", field)
+	c.String(http.StatusOK, value)
+	c.Abort()
+}
+
+// RadiusUnknownClient answers with an empty body, making the Freeradius rest xlat expand to nothing
+func RadiusUnknownClient(c *gin.Context, logger *logrus.Entry, args ...interface{}) {
+	logFromVariableArgs(logger, "Unknown dynamic client", args...)
+	c.AbortWithStatus(http.StatusNotFound)
+}
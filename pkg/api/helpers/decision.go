@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	decisionKey       = "ripradius.decision"
+	decisionSourceKey = "ripradius.decision_source"
+)
+
+// SetDecisionSource records where the answer to the request comes from, the authenticator by default
+func SetDecisionSource(c *gin.Context, source string) {
+	c.Set(decisionSourceKey, source)
+}
+
+func setDecision(c *gin.Context, result string, vlanId uint16, role string, reason string) {
+	source := c.GetString(decisionSourceKey)
+	if len(source) == 0 {
+		source = audit.AuthenticatorSource
+	}
+	c.Set(decisionKey, audit.Decision{
+		Result: result,
+		Source: source,
+		VLAN:   vlanId,
+		Role:   role,
+		Reason: reason,
+	})
+}
+
+// GetDecision returns the answer given to the request, if any
+func GetDecision(c *gin.Context) (audit.Decision, bool) {
+	value, found := c.Get(decisionKey)
+	if !found {
+		return audit.Decision{}, false
+	}
+	decision, ok := value.(audit.Decision)
+	return decision, ok
+}
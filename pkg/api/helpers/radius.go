@@ -1,70 +1,102 @@
 package helpers
 
 import (
+	"fmt"
 	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"github.com/creasty/defaults"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"net/http"
 )
 
-func logFromVariableArgs(logger *logrus.Entry, defaultMessage string, args ...interface{}) {
+func logFromVariableArgs(logger *logrus.Entry, defaultMessage string, args ...interface{}) string {
+	message := defaultMessage
 	switch len(args) {
 	case 0:
-		logger.Info(defaultMessage)
 	case 1:
-		msg, ok := args[0].(string)
-		if ok {
-			logger.Info(msg)
-		} else {
-			logger.Info(defaultMessage)
+		if msg, ok := args[0].(string); ok {
+			message = msg
 		}
 	default:
-		msg, ok := args[0].(string)
-		if ok {
-			logger.Infof(msg, args[1:]...)
-		} else {
-			logger.Info(defaultMessage)
+		if msg, ok := args[0].(string); ok {
+			message = fmt.Sprintf(msg, args[1:]...)
 		}
 	}
+	logger.Info(message)
+	return message
 }
 
 func RadiusReject(c *gin.Context, logger *logrus.Entry, args ...interface{}) {
-	logFromVariableArgs(logger, "Rejecting user", args...)
+	setDecision(c, audit.RejectResult, 0, "", logFromVariableArgs(logger, "Rejecting user", args...))
 	c.AbortWithStatusJSON(http.StatusUnauthorized, binding.RadiusRejectResponse{AuthType: "Reject"})
 
 }
 
-func RadiusAcceptUser(c *gin.Context, password string, vlanId uint16, logger *logrus.Entry, args ...interface{}) {
+// RadiusAcceptUser answers with the user VLAN and attributes, translating the VLAN and role for the NAS vendor profile if any
+func RadiusAcceptUser(c *gin.Context, profile *radius.VendorProfile, password string, vlanId uint16, role string, attributes radius.Attributes, logger *logrus.Entry, args ...interface{}) {
+	if profile != nil {
+		attributes = attributes.Merge(profile.Apply(vlanId, role))
+	}
 	response := &binding.RadiusUserResponse{
 		VLAN:     vlanId,
 		Password: password,
 		TunnelMedium: "IEEE-802",
 		TunnelType: "VLAN",
+		Attributes: attributes,
 	}
-	if err := defaults.Set(c); err != nil {
+	if err := defaults.Set(response); err != nil {
 		logger.Errorf("Cannot populate authorize response with defaults: %s", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, map[string]string{
 			"message": "Cannot create user response",
 		})
 		return
 	}
-	logFromVariableArgs(logger, "Accepting user", args...)
+	setDecision(c, audit.AcceptResult, vlanId, role, logFromVariableArgs(logger, "Accepting user", args...))
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
+
+// RadiusAcceptDevice answers with the device PSK, if any, and VLAN, in the attributes expected by the NAS vendor profile if any
+func RadiusAcceptDevice(c *gin.Context, profile *radius.VendorProfile, psk string, vlanId uint16, role string, attributes radius.Attributes, logger *logrus.Entry, args ...interface{}) {
+	if profile != nil {
+		attributes = attributes.Merge(profile.Apply(vlanId, role))
+	}
+	if len(psk) > 0 {
+		attributes = append(attributes, profile.PskAttributes(psk)...)
+	}
+	response := &binding.RadiusDeviceResponse{
+		AuthType:   "Accept",
+		VLAN:       vlanId,
+		Attributes: attributes,
+	}
+	if err := defaults.Set(response); err != nil {
+		logger.Errorf("Cannot populate authorize response with defaults: %s", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, map[string]string{
+			"message": "Cannot create device response",
+		})
+		return
+	}
+	setDecision(c, audit.AcceptResult, vlanId, role, logFromVariableArgs(logger, "Accepting device", args...))
 	c.AbortWithStatusJSON(http.StatusOK, response)
 }
 
-func RadiusAcceptAdmin(c *gin.Context, password string, class string, logger *logrus.Entry, args ...interface{}) {
+// RadiusAcceptAdmin answers with the admin password, Class and privilege attributes
+func RadiusAcceptAdmin(c *gin.Context, password string, class string, attributes radius.Attributes, logger *logrus.Entry, args ...interface{}) {
+	if len(class) > 0 {
+		attributes = append(radius.Attributes{{Name: "Class", Type: radius.OctetsType, Value: class}}, attributes...)
+	}
 	response := &binding.RadiusAdminResponse{
-		Password: password,
-		Class: class,
+		Password:   password,
+		Attributes: attributes,
 	}
-	if err := defaults.Set(c); err != nil {
+	if err := defaults.Set(response); err != nil {
 		logger.Errorf("Cannot populate authorize response with defaults: %s", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, map[string]string{
 			"message": "Cannot create admin response",
 		})
 		return
 	}
-	logFromVariableArgs(logger, "Accepting user", args...)
+	setDecision(c, audit.AcceptResult, 0, class, logFromVariableArgs(logger, "Accepting admin", args...))
 	c.AbortWithStatusJSON(http.StatusOK, response)
 }
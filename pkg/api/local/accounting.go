@@ -0,0 +1,51 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (s *Server) accounting(c *gin.Context) {
+	request := binding.AccountingRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		s.log.Errorf("Cannot decode JSON accounting request: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	mac := request.GetClientMac()
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":    request.Username,
+		"src_mac": mac,
+		"src_ip":  request.GetNas(),
+	})
+	record := session.Record{
+		Status: request.Status,
+		Time:   time.Now(),
+		Session: session.Session{
+			ID:             request.SessionId,
+			Username:       request.Username,
+			Mac:            mac,
+			Nas:            request.GetNas(),
+			Source:         request.ClientIp,
+			NasPort:        request.NasPort,
+			FramedIP:       request.FramedIp,
+			InputBytes:     request.InputBytes(),
+			OutputBytes:    request.OutputBytes(),
+			Duration:       request.SessionTime,
+			TerminateCause: request.TerminateCause,
+		},
+	}
+	if vlan, err := strconv.ParseUint(request.VLAN, 10, 16); err == nil {
+		record.VLAN = uint16(vlan)
+	} else if vlanId, _, found := s.sessionAuthorization(record.Session); found {
+		// Accounting requests rarely carry the VLAN, use the authorization one
+		record.VLAN = vlanId
+	}
+	logger.Tracef("Accounting %s for session %s", request.Status, request.SessionId)
+	s.sessions.Update(record)
+	c.AbortWithStatus(http.StatusNoContent)
+}
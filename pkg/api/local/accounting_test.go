@@ -0,0 +1,73 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"net/http"
+	"testing"
+)
+
+func TestAccountingVlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		add      func(c *cache.Cache) error
+		username string
+		vlan     string
+		wantVlan uint16
+	}{
+		{
+			name:     "from the request",
+			add:      func(c *cache.Cache) error { return nil },
+			username: "alice",
+			vlan:     "40",
+			wantVlan: 40,
+		},
+		{
+			name: "from the user",
+			add: func(c *cache.Cache) error {
+				return c.AddUser(cache.User{Username: "alice", Mac: "aa:bb:cc:dd:ee:ff", Password: "{clear}password", VlanId: 10})
+			},
+			username: "alice",
+			wantVlan: 10,
+		},
+		{
+			name: "from the PSK device",
+			add: func(c *cache.Cache) error {
+				return c.AddDevice(cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Psk: "psk", VlanId: 20})
+			},
+			username: "device",
+			wantVlan: 20,
+		},
+		{
+			name: "from the MAB device",
+			add: func(c *cache.Cache) error {
+				return c.AddDevice(cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Mab: true, VlanId: 30})
+			},
+			username: "aabbccddeeff",
+			wantVlan: 30,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+			if err := test.add(server.cache); err != nil {
+				t.Fatal(err)
+			}
+			if response := server.serve(http.MethodPost, "/api/v1/accounting", binding.AccountingRequest{
+				Status:    session.StartStatus,
+				SessionId: "1",
+				Username:  test.username,
+				ClientIp:  "192.0.2.1",
+				ClientMac: "AA-BB-CC-DD-EE-FF",
+				VLAN:      test.vlan,
+			}); response.Code != http.StatusNoContent {
+				t.Fatalf("got status %d, want %d", response.Code, http.StatusNoContent)
+			}
+			found, ok := server.sessions.Get("1")
+			if !ok || found.VLAN != test.wantVlan {
+				t.Fatalf("got session %v with VLAN %d, want VLAN %d", ok, found.VLAN, test.wantVlan)
+			}
+		})
+	}
+}
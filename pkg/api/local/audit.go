@@ -0,0 +1,167 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/api/helpers"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// cachedSource returns the decision source of a cached answer
+func (s *Server) cachedSource() string {
+	if s.health.State() == health.Offline {
+		return audit.OfflineSource
+	}
+	return audit.CacheSource
+}
+
+// recordDecision publishes the answer to an authorize request and keeps it until Freeradius posts its outcome
+func (s *Server) recordDecision(c *gin.Context, request *binding.UserRequest) {
+	decision, found := helpers.GetDecision(c)
+	if !found {
+		return
+	}
+	s.events.Publish(events.Event{
+		Type:     events.AuthorizeEvent,
+		Username: request.Username,
+		Mac:      request.GetClientMac(),
+		Nas:      request.GetNas(),
+		Message:  decision.Reason,
+		Data: map[string]interface{}{
+			"result":         decision.Result,
+			"source":         decision.Source,
+			"vlan":           decision.VLAN,
+			"role":           decision.Role,
+			"virtual_server": request.VirtualServer,
+		},
+	})
+	if s.audit != nil {
+		s.audit.Decide(request.Username, request.GetClientMac(), decision)
+	}
+}
+
+func (s *Server) postAuth(c *gin.Context) {
+	request := binding.PostAuthRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		s.log.Errorf("Cannot decode JSON post-auth request: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if request.VirtualServer == binding.MabVirtualServer {
+		// MAB decisions are recorded with the normalized MAC address as username
+		if mac, err := radius.NormalizeMAC(request.Username); err == nil {
+			request.Username = mac
+		}
+	}
+	entry := audit.Entry{
+		Username:      request.Username,
+		Mac:           request.GetClientMac(),
+		Nas:           request.GetNas(),
+		Ssid:          request.GetSsid(),
+		VirtualServer: request.VirtualServer,
+		Result:        request.Result,
+		Reason:        request.Reason,
+	}
+	if vlan, err := strconv.ParseUint(request.VLAN, 10, 16); err == nil {
+		entry.VLAN = uint16(vlan)
+	}
+	if s.audit != nil {
+		entry = s.audit.Record(entry)
+	}
+	message := "Authentication " + entry.Result
+	if len(entry.Reason) > 0 {
+		message += ": " + entry.Reason
+	}
+	s.events.Publish(events.Event{
+		Type:     events.PostAuthEvent,
+		Username: entry.Username,
+		Mac:      entry.Mac,
+		Nas:      entry.Nas,
+		Message:  message,
+		Data: map[string]interface{}{
+			"result":         entry.Result,
+			"source":         entry.Source,
+			"decision":       entry.Decision,
+			"vlan":           entry.VLAN,
+			"ssid":           entry.Ssid,
+			"virtual_server": entry.VirtualServer,
+		},
+	})
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":    entry.Username,
+		"src_mac": entry.Mac,
+		"src_ip":  entry.Nas,
+	})
+	if entry.Result == audit.RejectResult && entry.Decision == audit.AcceptResult {
+		logger.Infof("Accepted user rejected by Freeradius: %s", entry.Reason)
+	} else {
+		logger.Tracef("Authentication %s from %s", entry.Result, entry.Source)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+func (s *Server) auditList(c *gin.Context) {
+	if s.audit == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, map[string]string{
+			"message": "audit log disabled",
+		})
+		return
+	}
+	filter := audit.Filter{
+		Username: c.Query("username"),
+		Nas:      c.Query("nas"),
+		Result:   c.Query("result"),
+		Source:   c.Query("source"),
+	}
+	if mac := c.Query("mac"); len(mac) > 0 {
+		var valid bool
+		if filter.Mac, valid = radius.CanonicalMAC(mac); !valid {
+			badQuery(c, "invalid mac")
+			return
+		}
+	}
+	if since := c.Query("since"); len(since) > 0 {
+		if duration, err := time.ParseDuration(since); err == nil {
+			filter.Since = time.Now().Add(-duration)
+		} else if date, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = date
+		} else {
+			badQuery(c, "invalid since, expecting a duration or a RFC 3339 date")
+			return
+		}
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		badQuery(c, "invalid offset")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSessionLimit)))
+	if err != nil || limit <= 0 {
+		badQuery(c, "invalid limit")
+		return
+	}
+	if limit > maxSessionLimit {
+		limit = maxSessionLimit
+	}
+	entries := s.audit.List(filter)
+	response := binding.AuditList{
+		Total:   len(entries),
+		Offset:  offset,
+		Limit:   limit,
+		Entries: []audit.Entry{},
+	}
+	if offset < len(entries) {
+		end := offset + limit
+		if end > len(entries) {
+			end = len(entries)
+		}
+		response.Entries = entries[offset:end]
+	}
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
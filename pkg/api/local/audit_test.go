@@ -0,0 +1,37 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"net/http"
+	"testing"
+)
+
+func TestAuditListQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "no filter", wantStatus: http.StatusOK},
+		{name: "mac", query: "?mac=AA-BB-CC-DD-EE-FF", wantStatus: http.StatusOK},
+		{name: "invalid mac", query: "?mac=not-a-mac", wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+			config := audit.Configuration{}
+			if err := config.Check(); err != nil {
+				t.Fatal(err)
+			}
+			auditLog, err := audit.New(server.log, &config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.SetAuditLog(auditLog)
+			if response := server.serve(http.MethodGet, "/api/v1/audit"+test.query, nil); response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *Server) cacheList(c *gin.Context) {
+	users := s.cache.ListUsers()
+	entries := make([]binding.CacheEntry, 0, len(users))
+	for _, user := range users {
+		entries = append(entries, binding.CacheEntry{
+			Username:   user.Username,
+			Mac:        user.Mac,
+			VLAN:       user.VlanId,
+			Created:    user.Created,
+			Age:        int64(time.Since(user.Created).Seconds()),
+			Password:   user.Password,
+			Role:       user.Role,
+			Attributes: user.Attributes,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if strings.EqualFold(entries[i].Username, entries[j].Username) {
+			return entries[i].Mac < entries[j].Mac
+		}
+		return strings.ToLower(entries[i].Username) < strings.ToLower(entries[j].Username)
+	})
+	c.AbortWithStatusJSON(http.StatusOK, entries)
+}
+
+func (s *Server) cacheEvict(c *gin.Context) {
+	username := c.Query("username")
+	if len(username) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
+			"message": "username is mandatory",
+		})
+		return
+	}
+	response := binding.CacheEvictResponse{}
+	if mac, found := c.GetQuery("mac"); found {
+		if s.cache.EvictUser(username, mac) {
+			response.Evicted = 1
+		}
+	} else {
+		response.Evicted = s.cache.EvictUsername(username)
+		// MAB devices are named after their MAC address
+		if mac, err := radius.NormalizeMAC(username); err == nil && s.cache.EvictMabDevice(mac) {
+			response.Evicted++
+		}
+	}
+	s.log.WithField("user", username).Infof("%d cache entries evicted", response.Evicted)
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
+
+func (s *Server) cacheFlush(c *gin.Context) {
+	response := binding.CacheEvictResponse{Evicted: s.cache.Flush()}
+	s.log.Infof("Cache flushed, %d entries evicted", response.Evicted)
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
@@ -0,0 +1,163 @@
+package local
+
+import (
+	"context"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/coa"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/creasty/defaults"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// authorizationAttributes returns the CoA attributes applying a VLAN and role decision on a NAS
+func (s *Server) authorizationAttributes(nas string, vlanId uint16, role string) radius.Attributes {
+	attributes := radius.Attributes{}
+	if profile := s.vendorProfile(nas); profile != nil {
+		attributes = profile.Apply(vlanId, role)
+	}
+	if vlanId > 0 {
+		attributes = attributes.Merge(radius.Attributes{
+			{Name: "Tunnel-Type", Value: "VLAN"},
+			{Name: "Tunnel-Medium-Type", Value: "IEEE-802"},
+			{Name: "Tunnel-Private-Group-Id", Value: strconv.Itoa(int(vlanId))},
+		})
+	}
+	return attributes
+}
+
+// activeSessions returns the active sessions of a user on a device
+func (s *Server) activeSessions(username string, mac string) []session.Session {
+	active := true
+	return s.sessions.List(session.Filter{Username: username, Mac: mac, Active: &active})
+}
+
+// revokeSessions disconnects the active sessions of a user refused by the authenticator, when configured
+func (s *Server) revokeSessions(username string, mac string, logger *log.Entry) {
+	if s.coa.OnRevoke() != coa.DisconnectAction {
+		return
+	}
+	for _, target := range s.activeSessions(username, mac) {
+		logger.Infof("Disconnecting session %s on %s", target.ID, target.Nas)
+		if err := s.coa.Disconnect(context.Background(), target); err != nil {
+			logger.Errorf("Cannot disconnect session %s on %s: %s", target.ID, target.Nas, err)
+		}
+	}
+}
+
+// changeSessions applies a new authorization to the active sessions of a user, when configured
+func (s *Server) changeSessions(username string, mac string, vlanId uint16, role string, logger *log.Entry) {
+	action := s.coa.OnChange()
+	if action == coa.NoAction {
+		return
+	}
+	for _, target := range s.activeSessions(username, mac) {
+		var err error
+		if action == coa.DisconnectAction {
+			logger.Infof("Disconnecting session %s on %s after authorization change", target.ID, target.Nas)
+			err = s.coa.Disconnect(context.Background(), target)
+		} else {
+			logger.Infof("Sending CoA for session %s on %s", target.ID, target.Nas)
+			err = s.coa.Change(context.Background(), target, s.authorizationAttributes(target.Nas, vlanId, role))
+		}
+		if err != nil {
+			logger.Errorf("Cannot update session %s on %s: %s", target.ID, target.Nas, err)
+		}
+	}
+}
+
+// sessionAuthorization returns the cached VLAN and role of a session, from its user or its PSK or MAB device
+func (s *Server) sessionAuthorization(target session.Session) (uint16, string, bool) {
+	if user, found := s.cache.GetUser(target.Username, target.Mac); found {
+		return user.VlanId, user.Role, true
+	}
+	if len(target.Mac) == 0 {
+		return 0, "", false
+	}
+	if device, _, found := s.cache.GetDeviceWithRefreshNeed(target.Mac); found {
+		return device.VlanId, device.Role, true
+	}
+	if device, _, found := s.cache.GetMabDeviceWithRefreshNeed(target.Mac); found {
+		return device.VlanId, device.Role, true
+	}
+	return 0, "", false
+}
+
+func (s *Server) kickSession(ctx context.Context, target session.Session, action string) binding.KickResult {
+	result := binding.KickResult{
+		SessionId: target.ID,
+		Username:  target.Username,
+		Mac:       target.Mac,
+		Nas:       target.Nas,
+	}
+	var err error
+	switch action {
+	case binding.CoAAction:
+		vlanId, role, found := s.sessionAuthorization(target)
+		if !found {
+			result.Error = "authorization not in cache"
+			return result
+		}
+		err = s.coa.Change(ctx, target, s.authorizationAttributes(target.Nas, vlanId, role))
+	default:
+		err = s.coa.Disconnect(ctx, target)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Acknowledged = true
+	return result
+}
+
+func (s *Server) kick(c *gin.Context) {
+	request := binding.KickRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		badQuery(c, err.Error())
+		return
+	}
+	if err := defaults.Set(&request); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(request.SessionId) == 0 && len(request.Username) == 0 && len(request.Mac) == 0 {
+		badQuery(c, "session_id, username or mac is mandatory")
+		return
+	}
+	mac := ""
+	if len(request.Mac) > 0 {
+		var valid bool
+		if mac, valid = radius.CanonicalMAC(request.Mac); !valid {
+			badQuery(c, "invalid mac")
+			return
+		}
+	}
+	if !s.coa.Enabled() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, map[string]string{
+			"message": coa.DisabledError.Error(),
+		})
+		return
+	}
+	var targets []session.Session
+	if len(request.SessionId) > 0 {
+		if found, ok := s.sessions.Get(request.SessionId); ok && found.Active() {
+			targets = append(targets, found)
+		}
+	} else {
+		targets = s.activeSessions(request.Username, mac)
+	}
+	if len(targets) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, map[string]string{
+			"message": "no active session found",
+		})
+		return
+	}
+	response := binding.KickResponse{Action: request.Action}
+	for _, target := range targets {
+		response.Results = append(response.Results, s.kickSession(c.Request.Context(), target, request.Action))
+	}
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
@@ -0,0 +1,74 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"net/http"
+	"testing"
+)
+
+func TestSessionAuthorization(t *testing.T) {
+	tests := []struct {
+		name      string
+		add       func(c *cache.Cache) error
+		target    session.Session
+		wantVlan  uint16
+		wantRole  string
+		wantFound bool
+	}{
+		{
+			name: "user",
+			add: func(c *cache.Cache) error {
+				return c.AddUser(cache.User{Username: "alice", Mac: "aa:bb:cc:dd:ee:ff", Password: "{clear}password", VlanId: 10, Role: "staff"})
+			},
+			target:    session.Session{Username: "alice", Mac: "aa:bb:cc:dd:ee:ff"},
+			wantVlan:  10,
+			wantRole:  "staff",
+			wantFound: true,
+		},
+		{
+			name: "PSK device",
+			add: func(c *cache.Cache) error {
+				return c.AddDevice(cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Psk: "psk", VlanId: 20, Role: "iot"})
+			},
+			target:    session.Session{Username: "device", Mac: "aa:bb:cc:dd:ee:ff"},
+			wantVlan:  20,
+			wantRole:  "iot",
+			wantFound: true,
+		},
+		{
+			name: "MAB device",
+			add: func(c *cache.Cache) error {
+				return c.AddDevice(cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Mab: true, VlanId: 30})
+			},
+			target:    session.Session{Username: "aabbccddeeff", Mac: "aa:bb:cc:dd:ee:ff"},
+			wantVlan:  30,
+			wantFound: true,
+		},
+		{
+			name:   "not in cache",
+			add:    func(c *cache.Cache) error { return nil },
+			target: session.Session{Username: "alice", Mac: "aa:bb:cc:dd:ee:ff"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+			if err := test.add(server.cache); err != nil {
+				t.Fatal(err)
+			}
+			vlanId, role, found := server.sessionAuthorization(test.target)
+			if found != test.wantFound || vlanId != test.wantVlan || role != test.wantRole {
+				t.Fatalf("got %v with VLAN %d and role %q, want %v with VLAN %d and role %q", found, vlanId, role, test.wantFound, test.wantVlan, test.wantRole)
+			}
+		})
+	}
+}
+
+func TestKickInvalidMac(t *testing.T) {
+	server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+	if response := server.serve(http.MethodPost, "/api/v1/kick", binding.KickRequest{Mac: "not-a-mac"}); response.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", response.Code, http.StatusBadRequest)
+	}
+}
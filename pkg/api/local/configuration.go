@@ -1,9 +1,14 @@
 package local
 
 import (
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"github.com/COSAE-FR/ripradius/pkg/utils"
 	"github.com/COSAE-FR/riputils/common"
 	"github.com/creasty/defaults"
+	"os"
+	"path"
+	"strings"
 )
 
 type Configuration struct {
@@ -11,6 +16,18 @@ type Configuration struct {
 	IPAddress string `yaml:"-"`
 	Port      uint32 `yaml:"port" default:"8812"`
 	Token     string `yaml:"token"`
+	// File holding the token generated when Token is empty, shared with radiusctl
+	TokenFile string `yaml:"token_file"`
+	// Answer from cache and refresh stale users in the background
+	BackgroundRefresh bool `yaml:"background_refresh"`
+	// VLAN of the devices unknown to the authenticator in MAC authentication bypass, rejected when 0
+	MabFallbackVlan uint16 `yaml:"mab_fallback_vlan"`
+	// Events buffered for each event stream client, dropped when it does not follow
+	EventBuffer int `yaml:"event_buffer" default:"256"`
+	// Reply attributes by NAS vendor, the first profile matching the NAS IP is used
+	VendorProfiles []radius.VendorProfile `yaml:"vendor_profiles"`
+	tokenGenerated bool
+	tokenErr       error
 }
 
 func (c *Configuration) Check() error {
@@ -25,8 +42,43 @@ func (c *Configuration) Check() error {
 		return err
 	}
 	c.IPAddress = ifIP.IP.String()
+	for i := range c.VendorProfiles {
+		if err := c.VendorProfiles[i].Check(); err != nil {
+			return err
+		}
+	}
 	if len(c.Token) == 0 {
-		c.Token = common.RandomHexString(32)
+		if len(c.TokenFile) == 0 {
+			c.TokenFile = path.Join(utils.RunDirectory, utils.Name+"-api.token")
+		}
+		content, err := os.ReadFile(c.TokenFile)
+		switch {
+		case err == nil && len(strings.TrimSpace(string(content))) > 0:
+			c.Token = strings.TrimSpace(string(content))
+		case err == nil || os.IsNotExist(err):
+			c.Token = common.RandomHexString(32)
+			c.tokenGenerated = true
+		default:
+			// Not fatal here, radiusctl run by another user cannot read the daemon token
+			c.tokenErr = fmt.Errorf("cannot read API token file: %w", err)
+		}
+	}
+	return nil
+}
+
+// TokenError returns the error reading the token file, the token is empty then
+func (c *Configuration) TokenError() error {
+	return c.tokenErr
+}
+
+// SaveToken writes a generated token to the token file, so that radiusctl can read it
+func (c *Configuration) SaveToken() error {
+	if !c.tokenGenerated {
+		return nil
+	}
+	if err := os.WriteFile(c.TokenFile, []byte(c.Token+"\n"), 0600); err != nil {
+		return fmt.Errorf("cannot write API token file: %w", err)
 	}
+	c.tokenGenerated = false
 	return nil
 }
@@ -0,0 +1,97 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigurationToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokenFile     func(t *testing.T) string
+		wantToken     string
+		wantGenerated bool
+		wantErr       bool
+	}{
+		{
+			name: "read from the token file",
+			tokenFile: func(t *testing.T) string {
+				file := filepath.Join(t.TempDir(), "api.token")
+				if err := os.WriteFile(file, []byte("shared token\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			wantToken: "shared token",
+		},
+		{
+			name: "generated without token file",
+			tokenFile: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "api.token")
+			},
+			wantGenerated: true,
+		},
+		{
+			name: "unreadable token file",
+			tokenFile: func(t *testing.T) string {
+				// A directory cannot be read as a file, like a token file of another user
+				return t.TempDir()
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Configuration{TokenFile: test.tokenFile(t)}
+			if err := config.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if (config.TokenError() != nil) != test.wantErr {
+				t.Fatalf("got token error %v, want error %v", config.TokenError(), test.wantErr)
+			}
+			if test.wantErr {
+				if len(config.Token) > 0 {
+					t.Fatalf("got token %q with an unreadable token file", config.Token)
+				}
+				return
+			}
+			if test.wantGenerated {
+				if len(config.Token) == 0 {
+					t.Fatal("no token generated")
+				}
+				if err := config.SaveToken(); err != nil {
+					t.Fatal(err)
+				}
+				info, err := os.Stat(config.TokenFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != 0600 {
+					t.Fatalf("token file mode %o, want 600", info.Mode().Perm())
+				}
+				reloaded := Configuration{TokenFile: config.TokenFile}
+				if err := reloaded.Check(); err != nil {
+					t.Fatal(err)
+				}
+				if reloaded.Token != config.Token {
+					t.Fatalf("got token %q from the token file, want %q", reloaded.Token, config.Token)
+				}
+				return
+			}
+			if config.Token != test.wantToken {
+				t.Fatalf("got token %q, want %q", config.Token, test.wantToken)
+			}
+		})
+	}
+}
+
+func TestConfigurationTokenSet(t *testing.T) {
+	config := Configuration{Token: "configured", TokenFile: t.TempDir()}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Token != "configured" || config.TokenError() != nil {
+		t.Fatalf("got token %q and error %v, want the configured token", config.Token, config.TokenError())
+	}
+}
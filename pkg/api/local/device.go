@@ -0,0 +1,104 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/api/helpers"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+)
+
+// deviceMac returns the MAC address of a device authorization, the User-Name when Calling-Station-Id is missing
+func deviceMac(deviceRequest *binding.UserRequest) (string, error) {
+	value := deviceRequest.GetClientMac()
+	if len(value) == 0 {
+		value = deviceRequest.Username
+	}
+	mac, err := radius.NormalizeMAC(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", cache.MalformedMacError, value)
+	}
+	return mac, nil
+}
+
+func (s *Server) refreshDevice(c *gin.Context, requestedDevice *binding.UserRequest, mac string, errorFunc gin.HandlerFunc) {
+	var upstreamErr error
+	logger := s.log.WithFields(map[string]interface{}{
+		"src_mac": mac,
+		"src_ip":  requestedDevice.ClientIp,
+	})
+	if !s.health.Available() {
+		logger.Debug("Authenticator offline, skipping device lookup")
+		errorFunc(c)
+		return
+	}
+	defer func() {
+		s.reportUpstream(c, upstreamErr)
+	}()
+	device, err := s.client.GetDevice(c.Request.Context(), requestedDevice)
+	if err != nil {
+		if errors.Is(err, client.UserRejectedError) || errors.Is(err, client.UserNotFoundError) {
+			logger.Debugf("Device refused by authenticator: %s", err)
+			s.cache.EvictDevice(mac)
+			s.cache.AddDeviceNegative(mac, err.Error())
+			helpers.RadiusReject(c, logger, "Rejecting device")
+			return
+		}
+		logger.Errorf("Error with authenticator: %s", err)
+		upstreamErr = err
+		errorFunc(c)
+		return
+	}
+	logger.Trace("Adding device to cache")
+	if err := s.cache.AddDevice(cache.Device{
+		Mac:        mac,
+		Psk:        device.Psk,
+		VlanId:     device.VLAN,
+		Role:       device.Role,
+		Attributes: device.Attributes,
+	}); err != nil {
+		logger.Errorf("Cannot add device to cache: %s", err)
+	}
+	helpers.RadiusAcceptDevice(c, s.vendorProfile(requestedDevice.ClientIp), device.Psk, device.VLAN, device.Role, device.Attributes, logger)
+}
+
+func (s *Server) deviceAuthorize(c *gin.Context, deviceRequest *binding.UserRequest) {
+	mac, err := deviceMac(deviceRequest)
+	if err != nil {
+		logger := s.log.WithField("src_ip", deviceRequest.ClientIp)
+		helpers.RadiusReject(c, logger, "Rejecting device: %s", err)
+		return
+	}
+	logger := s.log.WithFields(map[string]interface{}{
+		"src_mac": mac,
+		"src_ip":  deviceRequest.ClientIp,
+	})
+	profile := s.vendorProfile(deviceRequest.ClientIp)
+	cachedDevice, mustRefresh, found := s.cache.GetDeviceWithRefreshNeed(mac)
+	if !found {
+		if negative, rejected := s.cache.GetDeviceNegative(mac); rejected {
+			helpers.SetDecisionSource(c, audit.NegativeCacheSource)
+			helpers.RadiusReject(c, logger, "Rejecting device from negative cache: %s", negative.Reason)
+			return
+		}
+		logger.Trace("Device not in cache, refreshing")
+		s.refreshDevice(c, deviceRequest, mac, func(c *gin.Context) {
+			helpers.RadiusReject(c, logger, "Rejecting device")
+		})
+		return
+	}
+	if mustRefresh {
+		logger.Trace("Device in cache for a while, refreshing")
+		s.refreshDevice(c, deviceRequest, mac, func(c *gin.Context) {
+			helpers.SetDecisionSource(c, audit.OfflineSource)
+			helpers.RadiusAcceptDevice(c, profile, cachedDevice.Psk, cachedDevice.VlanId, cachedDevice.Role, cachedDevice.Attributes, logger)
+		})
+		return
+	}
+	helpers.SetDecisionSource(c, s.cachedSource())
+	helpers.RadiusAcceptDevice(c, profile, cachedDevice.Psk, cachedDevice.VlanId, cachedDevice.Role, cachedDevice.Attributes, logger)
+}
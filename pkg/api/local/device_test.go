@@ -0,0 +1,64 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"net/http"
+	"testing"
+)
+
+func TestDeviceMac(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    binding.UserRequest
+		wantStatus int
+		wantCalls  int
+		wantMac    string
+	}{
+		{
+			name:       "calling station",
+			request:    binding.UserRequest{Username: "device", ClientMac: "AA-BB-CC-DD-EE-FF"},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+			wantMac:    "aa:bb:cc:dd:ee:ff",
+		},
+		{
+			name:       "user name",
+			request:    binding.UserRequest{Username: "AABBCCDDEEFF"},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+			wantMac:    "aa:bb:cc:dd:ee:ff",
+		},
+		{
+			name:       "malformed calling station",
+			request:    binding.UserRequest{Username: "AABBCCDDEEFF", ClientMac: "not-a-mac"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "malformed user name",
+			request:    binding.UserRequest{Username: "device"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{}, map[string]http.HandlerFunc{
+				"/api/v1/device": answer(http.StatusOK, binding.UpstreamDeviceResponse{Psk: "device psk", VLAN: 20}),
+			})
+			request := test.request
+			request.ClientIp = "192.0.2.1"
+			request.VirtualServer = binding.PskVirtualServer
+			if response := server.authorize(request); response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+			if calls := server.upstream.Calls("/api/v1/device"); calls != test.wantCalls {
+				t.Fatalf("authenticator called %d times, want %d", calls, test.wantCalls)
+			}
+			if len(test.wantMac) > 0 {
+				if device, _, found := server.cache.GetDeviceWithRefreshNeed(test.wantMac); !found || device.VlanId != 20 {
+					t.Fatalf("got cached device %v with VLAN %d, want VLAN 20", found, device.VlanId)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// eventKeepAlive is the interval of the comments keeping idle streams open through proxies
+const eventKeepAlive = 15 * time.Second
+
+// eventStream sends the events selected by the query as Server-Sent Events until the client leaves
+func (s *Server) eventStream(c *gin.Context) {
+	if s.events == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, map[string]string{
+			"message": "event stream disabled",
+		})
+		return
+	}
+	filter := events.Filter{
+		Username: c.Query("username"),
+		Nas:      c.Query("nas"),
+	}
+	if mac := c.Query("mac"); len(mac) > 0 {
+		var valid bool
+		if filter.Mac, valid = radius.CanonicalMAC(mac); !valid {
+			badQuery(c, "invalid mac")
+			return
+		}
+	}
+	if types := c.Query("type"); len(types) > 0 {
+		filter.Types = strings.Split(types, ",")
+	}
+	subscription := s.events.Subscribe(filter)
+	logger := s.log.WithField("src_ip", c.ClientIP())
+	logger.Debug("Event stream opened")
+	defer func() {
+		if dropped := s.events.Unsubscribe(subscription); dropped > 0 {
+			logger.Warnf("Event stream closed, %d events dropped for a slow client", dropped)
+			return
+		}
+		logger.Debug("Event stream closed")
+	}()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// Send the headers now, the client waits for them before reading events
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, open := <-subscription.Events():
+			if !open {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-keepAlive.C:
+			_, err := w.Write([]byte(": keep-alive\n\n"))
+			return err == nil
+		}
+	})
+}
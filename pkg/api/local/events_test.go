@@ -0,0 +1,53 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventStreamInvalidMac(t *testing.T) {
+	server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+	server.SetEventBus(events.New(10))
+	if response := server.serve(http.MethodGet, "/api/v1/events?mac=not-a-mac", nil); response.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEventNas(t *testing.T) {
+	server := newTestServer(t, Configuration{}, cache.Configuration{}, map[string]http.HandlerFunc{
+		"/api/v1/authorize": acceptUser(10),
+	})
+	bus := events.New(10)
+	server.SetEventBus(bus)
+	// Both steps of the authentication are selected by the NAS-IP-Address
+	subscription := bus.Subscribe(events.Filter{Nas: "198.51.100.1", Types: []string{events.AuthorizeEvent, events.PostAuthEvent}})
+	request := aliceRequest
+	request.NasIp = "198.51.100.1"
+	if response := server.authorize(request); response.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", response.Code, http.StatusOK)
+	}
+	if response := server.serve(http.MethodPost, "/api/v1/post-auth", binding.PostAuthRequest{
+		Result:        "accept",
+		Username:      request.Username,
+		ClientIp:      request.ClientIp,
+		NasIp:         request.NasIp,
+		VirtualServer: request.VirtualServer,
+		ClientMac:     request.ClientMac,
+	}); response.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", response.Code, http.StatusNoContent)
+	}
+	for _, want := range []string{events.AuthorizeEvent, events.PostAuthEvent} {
+		select {
+		case event := <-subscription.Events():
+			if event.Type != want || event.Nas != request.NasIp {
+				t.Fatalf("got %s event from %s, want %s event from %s", event.Type, event.Nas, want, request.NasIp)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+}
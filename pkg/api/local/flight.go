@@ -0,0 +1,54 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"sync"
+)
+
+type userCall struct {
+	done chan bool
+	user *binding.RadiusUserResponse
+	err  error
+}
+
+// userFlight shares a single upstream user lookup between concurrent requests for the same cache key
+type userFlight struct {
+	calls     map[string]*userCall
+	coalesced int
+	sync.Mutex
+}
+
+func newUserFlight() *userFlight {
+	return &userFlight{calls: make(map[string]*userCall)}
+}
+
+// Do runs lookup, unless a lookup for key is already running, and returns its result.
+// The last returned value is true when the result comes from another request lookup.
+func (f *userFlight) Do(key string, lookup func() (*binding.RadiusUserResponse, error)) (*binding.RadiusUserResponse, error, bool) {
+	f.Lock()
+	if call, found := f.calls[key]; found {
+		f.coalesced++
+		f.Unlock()
+		<-call.done
+		return call.user, call.err, true
+	}
+	call := &userCall{done: make(chan bool)}
+	f.calls[key] = call
+	f.Unlock()
+
+	defer func() {
+		f.Lock()
+		delete(f.calls, key)
+		f.Unlock()
+		close(call.done)
+	}()
+	call.user, call.err = lookup()
+	return call.user, call.err, false
+}
+
+// Coalesced returns the number of requests which reused another request lookup
+func (f *userFlight) Coalesced() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.coalesced
+}
@@ -1,58 +1,234 @@
 package local
 
 import (
+	"context"
 	"errors"
 	"github.com/COSAE-FR/ripradius/pkg/api/binding"
 	"github.com/COSAE-FR/ripradius/pkg/api/helpers"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
 	"github.com/COSAE-FR/ripradius/pkg/local/cache"
 	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"github.com/gin-gonic/gin"
+	"net"
 	"net/http"
 )
 
+// lookupUser asks the authenticator for a user, sharing the answer with the concurrent lookups of the same key.
+// The lookup must not end with the request that started it, nor outlive the longest upstream call:
+// refreshes, revocations and CoA wait for it.
+func (s *Server) lookupUser(key string, requestedUser *binding.UserRequest) (*binding.RadiusUserResponse, error, bool) {
+	return s.users.Do(key, func() (*binding.RadiusUserResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), s.client.MaxCallDuration())
+		defer cancel()
+		return s.client.GetUser(ctx, requestedUser)
+	})
+}
+
+// refreshUser asks the authenticator for a user, errorFunc answers when the authenticator cannot be reached
 func (s *Server) refreshUser(c *gin.Context, requestedUser *binding.UserRequest, errorFunc gin.HandlerFunc) {
-	var serverOffline bool
+	var upstreamErr error
 	logger := s.log.WithFields(map[string]interface{}{
 		"user":    requestedUser.Username,
 		"src_mac": requestedUser.GetClientMac(),
 		"src_ip":  requestedUser.ClientIp,
 	})
-	defer func() {
-		if serverOffline {
-			logger.Debug("Enabling offline mode")
-			s.cache.SetOffline()
-		} else {
-			logger.Trace("Enabling online mode")
-			s.cache.SetOnline()
+	if !s.health.Available() {
+		logger.Debug("Authenticator offline, skipping user lookup")
+		errorFunc(c)
+		return
+	}
+	user, err, coalesced := s.lookupUser(cache.UserKey(requestedUser.Username, requestedUser.GetClientMac()), requestedUser)
+	if coalesced {
+		logger.Trace("Authenticator answer shared with a concurrent request")
+	} else {
+		defer func() {
+			s.health.Report(upstreamErr)
+		}()
+	}
+	if err != nil {
+		if errors.Is(err, client.UserRejectedError) || errors.Is(err, client.UserNotFoundError) {
+			logger.Debugf("User refused by authenticator: %s", err)
+			if !coalesced {
+				s.cache.EvictUser(requestedUser.Username, requestedUser.GetClientMac())
+				s.cache.AddNegative(requestedUser.Username, requestedUser.GetClientMac(), err.Error())
+			}
+			helpers.RadiusReject(c, logger)
+			return
+		}
+		logger.Errorf("Error with authenticator: %s", err)
+		upstreamErr = err
+		errorFunc(c)
+		return
+	}
+	if !coalesced {
+		logger.Trace("Adding user to cache")
+		if err := s.cache.AddUser(cache.User{
+			Username:   requestedUser.Username,
+			Password:   user.Password,
+			Mac:        requestedUser.GetClientMac(),
+			VlanId:     user.VLAN,
+			Role:       user.Role,
+			Attributes: user.Attributes,
+		}); err != nil {
+			logger.Errorf("Cannot add user to cache: %s", err)
+		}
+	}
+	helpers.RadiusAcceptUser(c, s.vendorProfile(requestedUser.ClientIp), user.Password, user.VLAN, user.Role, user.Attributes, logger)
+}
+
+// backgroundRefresh refreshes a cached user without blocking the RADIUS request.
+// A user refused by the authenticator is evicted, so the next request is rejected.
+func (s *Server) backgroundRefresh(requestedUser binding.UserRequest, cachedUser cache.User) {
+	if !s.health.Available() {
+		return
+	}
+	key := cache.UserKey(requestedUser.Username, requestedUser.GetClientMac())
+	s.refreshLock.Lock()
+	if s.refreshing[key] {
+		s.refreshLock.Unlock()
+		return
+	}
+	s.refreshing[key] = true
+	s.refreshLock.Unlock()
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":    requestedUser.Username,
+		"src_mac": requestedUser.GetClientMac(),
+		"src_ip":  requestedUser.ClientIp,
+	})
+	go func() {
+		defer func() {
+			s.refreshLock.Lock()
+			delete(s.refreshing, key)
+			s.refreshLock.Unlock()
+		}()
+		user, err, coalesced := s.lookupUser(key, &requestedUser)
+		if coalesced {
+			// The concurrent request already updated the cache
+			return
+		}
+		if err != nil {
+			if errors.Is(err, client.UserRejectedError) || errors.Is(err, client.UserNotFoundError) {
+				logger.Infof("User refused by authenticator, evicting from cache: %s", err)
+				s.cache.EvictUser(requestedUser.Username, requestedUser.GetClientMac())
+				s.cache.AddNegative(requestedUser.Username, requestedUser.GetClientMac(), err.Error())
+				s.health.Success()
+				s.revokeSessions(requestedUser.Username, requestedUser.GetClientMac(), logger)
+				return
+			}
+			logger.Errorf("Error with authenticator: %s", err)
+			s.health.Failure(err)
+			return
+		}
+		s.health.Success()
+		if user.VLAN != cachedUser.VlanId {
+			logger.Infof("User VLAN changed from %d to %d", cachedUser.VlanId, user.VLAN)
+		}
+		if user.Role != cachedUser.Role {
+			logger.Infof("User role changed from %q to %q", cachedUser.Role, user.Role)
+		}
+		logger.Trace("Updating user in cache")
+		if err := s.cache.AddUser(cache.User{
+			Username:   requestedUser.Username,
+			Password:   user.Password,
+			Mac:        requestedUser.GetClientMac(),
+			VlanId:     user.VLAN,
+			Role:       user.Role,
+			Attributes: user.Attributes,
+		}); err != nil {
+			logger.Errorf("Cannot add user to cache: %s", err)
+		}
+		if user.VLAN != cachedUser.VlanId || user.Role != cachedUser.Role {
+			s.changeSessions(requestedUser.Username, requestedUser.GetClientMac(), user.VLAN, user.Role, logger)
 		}
 	}()
-	user, err := s.client.GetUser(requestedUser)
-	if err != nil {
-		if errors.Is(err, client.UserRejectedError) {
-			logger.Debugf("User rejected by authenticator")
-			errorFunc(c)
+}
+
+func (s *Server) refreshAdmin(c *gin.Context, requestedAdmin *binding.UserRequest, cachedAdmin *cache.Admin) {
+	var upstreamErr error
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":   requestedAdmin.Username,
+		"src_ip": requestedAdmin.ClientIp,
+	})
+	offline := func() {
+		if cachedAdmin != nil && s.cache.AllowOfflineAdmin() {
+			helpers.SetDecisionSource(c, audit.OfflineSource)
+			helpers.RadiusAcceptAdmin(c, cachedAdmin.Password, cachedAdmin.Class, cachedAdmin.Attributes, logger, "Accepting cached admin while offline")
 			return
 		}
-		if errors.Is(err, client.UserNotFoundError) {
-			logger.Debugf("User not found by authenticator")
-			errorFunc(c)
+		helpers.RadiusReject(c, logger, "Rejecting admin")
+	}
+	if !s.health.Available() {
+		logger.Debug("Authenticator offline, skipping admin lookup")
+		offline()
+		return
+	}
+	defer func() {
+		s.reportUpstream(c, upstreamErr)
+	}()
+	admin, err := s.client.GetAdmin(c.Request.Context(), requestedAdmin)
+	if err != nil {
+		if errors.Is(err, client.UserRejectedError) || errors.Is(err, client.UserNotFoundError) {
+			logger.Debugf("Admin refused by authenticator: %s", err)
+			s.cache.RemoveAdmin(requestedAdmin.Username, requestedAdmin.ClientIp)
+			helpers.RadiusReject(c, logger, "Rejecting admin")
 			return
 		}
 		logger.Errorf("Error with authenticator: %s", err)
-		serverOffline = true
-		errorFunc(c)
+		upstreamErr = err
+		offline()
 		return
 	}
-	logger.Trace("Adding user to cache")
-	if err := s.cache.AddUser(cache.User{
-		Username: requestedUser.Username,
-		Password: user.Password,
-		Mac:      requestedUser.GetClientMac(),
-		VlanId:   user.VLAN,
+	logger.Trace("Adding admin to cache")
+	if err := s.cache.AddAdmin(cache.Admin{
+		Username:   requestedAdmin.Username,
+		Password:   admin.Password,
+		Nas:        requestedAdmin.ClientIp,
+		Class:      admin.Class,
+		Attributes: admin.Attributes,
 	}); err != nil {
-		logger.Errorf("Cannot add user to cache: %s", err)
+		logger.Errorf("Cannot add admin to cache: %s", err)
 	}
-	helpers.RadiusAcceptUser(c, user.Password, user.VLAN, logger)
+	helpers.RadiusAcceptAdmin(c, admin.Password, admin.Class, admin.Attributes, logger)
+}
+
+func (s *Server) adminAuthorize(c *gin.Context, adminRequest *binding.UserRequest) {
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":   adminRequest.Username,
+		"src_ip": adminRequest.ClientIp,
+	})
+	cachedAdmin, mustRefresh, found := s.cache.GetAdminWithRefreshNeed(adminRequest.Username, adminRequest.ClientIp)
+	if !found {
+		logger.Trace("Admin not in cache, refreshing")
+		s.refreshAdmin(c, adminRequest, nil)
+		return
+	}
+	if mustRefresh {
+		logger.Trace("Admin in cache for a while, refreshing")
+		s.refreshAdmin(c, adminRequest, &cachedAdmin)
+		return
+	}
+	helpers.SetDecisionSource(c, s.cachedSource())
+	helpers.RadiusAcceptAdmin(c, cachedAdmin.Password, cachedAdmin.Class, cachedAdmin.Attributes, logger)
+}
+
+// reportUpstream records the result of an upstream call made for c, unless c ended first:
+// the call was then cancelled by Freeradius, not failed by the authenticator
+func (s *Server) reportUpstream(c *gin.Context, err error) {
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	s.health.Report(err)
+}
+
+// vendorProfile returns the vendor profile of a NAS, nil for the standard attributes
+func (s *Server) vendorProfile(ip string) *radius.VendorProfile {
+	for i := range s.config.VendorProfiles {
+		if s.config.VendorProfiles[i].Match(ip) {
+			return &s.config.VendorProfiles[i]
+		}
+	}
+	return nil
 }
 
 func (s *Server) userAuthorize(c *gin.Context) {
@@ -62,6 +238,22 @@ func (s *Server) userAuthorize(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	userRequest.Normalize()
+	defer s.recordDecision(c, &userRequest)
+	if userRequest.MacMalformed {
+		s.log.WithField("user", userRequest.Username).Warnf("Malformed client MAC address: %s", userRequest.GetClientMac())
+	}
+	switch userRequest.VirtualServer {
+	case binding.AdminVirtualServer:
+		s.adminAuthorize(c, &userRequest)
+		return
+	case binding.PskVirtualServer:
+		s.deviceAuthorize(c, &userRequest)
+		return
+	case binding.MabVirtualServer:
+		s.mabAuthorize(c, &userRequest)
+		return
+	}
 	logger := s.log.WithFields(map[string]interface{}{
 		"user":    userRequest.Username,
 		"src_mac": userRequest.GetClientMac(),
@@ -69,23 +261,116 @@ func (s *Server) userAuthorize(c *gin.Context) {
 	})
 	cachedUser, mustRefresh, found := s.cache.GetUserWithRefreshNeed(userRequest.Username, userRequest.GetClientMac())
 	if !found {
+		if negative, rejected := s.cache.GetNegative(userRequest.Username, userRequest.GetClientMac()); rejected {
+			helpers.SetDecisionSource(c, audit.NegativeCacheSource)
+			helpers.RadiusReject(c, logger, "Rejecting user from negative cache: %s", negative.Reason)
+			return
+		}
 		logger.Trace("User not in cache, refreshing")
 		s.refreshUser(c, &userRequest, func(c *gin.Context) {
 			helpers.RadiusReject(c, logger)
 		})
 		return
 	}
+	if mustRefresh && s.config.BackgroundRefresh {
+		logger.Trace("User in cache for a while, refreshing in background")
+		helpers.SetDecisionSource(c, s.cachedSource())
+		helpers.RadiusAcceptUser(c, s.vendorProfile(userRequest.ClientIp), cachedUser.Password, cachedUser.VlanId, cachedUser.Role, cachedUser.Attributes, logger)
+		s.backgroundRefresh(userRequest, cachedUser)
+		return
+	}
 	if mustRefresh {
 		logger.Trace("User in cache for a while, refreshing")
 		s.refreshUser(c, &userRequest, func(c *gin.Context) {
-			helpers.RadiusAcceptUser(c, cachedUser.Password, cachedUser.VlanId, logger)
+			helpers.SetDecisionSource(c, audit.OfflineSource)
+			helpers.RadiusAcceptUser(c, s.vendorProfile(userRequest.ClientIp), cachedUser.Password, cachedUser.VlanId, cachedUser.Role, cachedUser.Attributes, logger)
 		})
 		return
 	}
-	helpers.RadiusAcceptUser(c, cachedUser.Password, cachedUser.VlanId, logger)
+	helpers.SetDecisionSource(c, s.cachedSource())
+	helpers.RadiusAcceptUser(c, s.vendorProfile(userRequest.ClientIp), cachedUser.Password, cachedUser.VlanId, cachedUser.Role, cachedUser.Attributes, logger)
+}
+
+// refreshClient resolves a NAS, errorFunc answers when the authenticator cannot be reached
+func (s *Server) refreshClient(c *gin.Context, ip string, errorFunc gin.HandlerFunc) {
+	var upstreamErr error
+	logger := s.log.WithField("src_ip", ip)
+	if !s.health.Available() {
+		logger.Debug("Authenticator offline, skipping client lookup")
+		errorFunc(c)
+		return
+	}
+	defer func() {
+		s.reportUpstream(c, upstreamErr)
+	}()
+	nas, err := s.client.GetDynamicClient(c.Request.Context(), ip)
+	if err != nil {
+		if errors.Is(err, client.ClientNotFoundError) {
+			s.cache.RemoveClient(ip)
+			helpers.RadiusUnknownClient(c, logger, "Client not found by authenticator")
+			return
+		}
+		logger.Errorf("Error with authenticator: %s", err)
+		upstreamErr = err
+		errorFunc(c)
+		return
+	}
+	logger.Trace("Adding client to cache")
+	if err := s.cache.AddClient(cache.Client{
+		IP:        ip,
+		Shortname: nas.Shortname,
+		Secret:    nas.Secret,
+		Server:    nas.Server,
+	}); err != nil {
+		logger.Errorf("Cannot add client to cache: %s", err)
+	}
+	helpers.RadiusDynamicClient(c, *nas, c.Query("return"), logger)
+}
+
+func (s *Server) dynamicClient(c *gin.Context) {
+	ip := c.Query("ip")
+	if net.ParseIP(ip) == nil {
+		s.log.Errorf("Invalid dynamic client IP: %s", ip)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	logger := s.log.WithField("src_ip", ip)
+	cachedClient, mustRefresh, found := s.cache.GetClientWithRefreshNeed(ip)
+	if !found {
+		logger.Trace("Client not in cache, refreshing")
+		s.refreshClient(c, ip, func(c *gin.Context) {
+			helpers.RadiusUnknownClient(c, logger)
+		})
+		return
+	}
+	cachedResponse := binding.DynamicClient{
+		Shortname: cachedClient.Shortname,
+		Secret:    cachedClient.Secret,
+		Server:    cachedClient.Server,
+	}
+	if mustRefresh {
+		logger.Trace("Client in cache for a while, refreshing")
+		s.refreshClient(c, ip, func(c *gin.Context) {
+			helpers.RadiusDynamicClient(c, cachedResponse, c.Query("return"), logger)
+		})
+		return
+	}
+	helpers.RadiusDynamicClient(c, cachedResponse, c.Query("return"), logger)
 }
 
 func (s *Server) status(c *gin.Context) {
 	cacheStatus := s.cache.Status()
-	c.AbortWithStatusJSON(http.StatusOK, &binding.ServerStatus{Cache: cacheStatus})
+	status := &binding.ServerStatus{
+		Cache:    cacheStatus,
+		Sessions: s.sessions.Status(),
+		Requests: binding.RequestStatus{
+			Coalesced: s.users.Coalesced(),
+		},
+		Upstream: s.client.Status(),
+		Health:   s.health.Status(),
+	}
+	if s.certificate != nil {
+		status.Certificate = s.certificate()
+	}
+	c.AbortWithStatusJSON(http.StatusOK, status)
 }
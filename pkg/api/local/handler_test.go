@@ -0,0 +1,227 @@
+package local
+
+import (
+	"errors"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var aliceRequest = binding.UserRequest{
+	Username:      "alice",
+	ClientIp:      "192.0.2.1",
+	VirtualServer: "wifi",
+	ClientMac:     "AA-BB-CC-DD-EE-FF",
+}
+
+func acceptUser(vlan uint16) http.HandlerFunc {
+	return answer(http.StatusOK, map[string]interface{}{
+		"config:Password-With-Header":   "{clear}password",
+		"reply:Tunnel-Private-Group-Id": vlan,
+	})
+}
+
+func TestBackgroundRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstream  http.HandlerFunc
+		wantVlan  uint16
+		wantFound bool
+		wantNeg   bool
+	}{
+		{
+			name:      "user changed",
+			upstream:  acceptUser(20),
+			wantVlan:  20,
+			wantFound: true,
+		},
+		{
+			name:     "user rejected",
+			upstream: answer(http.StatusUnauthorized, map[string]string{}),
+			wantNeg:  true,
+		},
+		{
+			name:      "authenticator error",
+			upstream:  answer(http.StatusInternalServerError, map[string]string{}),
+			wantVlan:  10,
+			wantFound: true,
+		},
+		{
+			name: "authenticator not answering",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			wantVlan:  10,
+			wantFound: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{BackgroundRefresh: true}, cache.Configuration{NegativeTTL: time.Minute}, map[string]http.HandlerFunc{
+				"/api/v1/authorize": test.upstream,
+			})
+			if err := server.cache.AddUser(cache.User{
+				Username: "alice",
+				Password: "{clear}password",
+				Mac:      "aa:bb:cc:dd:ee:ff",
+				VlanId:   10,
+				Created:  time.Now().Add(-2 * time.Hour),
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// The stale user is answered from cache, without waiting for the authenticator
+			if response := server.authorize(aliceRequest); response.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", response.Code, http.StatusOK)
+			}
+			server.waitRefreshes(t, server.client.MaxCallDuration()+time.Second)
+			if calls := server.upstream.Calls("/api/v1/authorize"); calls != 1 {
+				t.Fatalf("authenticator called %d times, want 1", calls)
+			}
+			user, found := server.cache.GetUser("alice", "aa:bb:cc:dd:ee:ff")
+			if found != test.wantFound || user.VlanId != test.wantVlan {
+				t.Fatalf("got cached user %v with VLAN %d, want %v with VLAN %d", found, user.VlanId, test.wantFound, test.wantVlan)
+			}
+			if _, rejected := server.cache.GetNegative("alice", "aa:bb:cc:dd:ee:ff"); rejected != test.wantNeg {
+				t.Fatalf("got negative entry %v, want %v", rejected, test.wantNeg)
+			}
+		})
+	}
+}
+
+func TestBackgroundRefreshOnce(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestServer(t, Configuration{BackgroundRefresh: true}, cache.Configuration{}, map[string]http.HandlerFunc{
+		"/api/v1/authorize": func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			acceptUser(10)(w, r)
+		},
+	})
+	if err := server.cache.AddUser(cache.User{Username: "alice", Password: "{clear}password", Mac: "aa:bb:cc:dd:ee:ff", VlanId: 10, Created: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if response := server.authorize(aliceRequest); response.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", response.Code, http.StatusOK)
+		}
+	}
+	close(release)
+	server.waitRefreshes(t, server.client.MaxCallDuration()+time.Second)
+	if calls := server.upstream.Calls("/api/v1/authorize"); calls != 1 {
+		t.Fatalf("authenticator called %d times, want 1", calls)
+	}
+}
+
+func TestLookupUserBounded(t *testing.T) {
+	server := newTestServer(t, Configuration{}, cache.Configuration{}, map[string]http.HandlerFunc{
+		"/api/v1/authorize": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		},
+	})
+	key := cache.UserKey("alice", "aa:bb:cc:dd:ee:ff")
+	started := time.Now()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			request := aliceRequest
+			_, err, _ := server.lookupUser(key, &request)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Fatal("lookup succeeded without answer")
+		}
+	}
+	// Both the lookup and the request sharing it end with the longest upstream call
+	if elapsed := time.Since(started); elapsed > server.client.MaxCallDuration()+500*time.Millisecond {
+		t.Fatalf("lookups ended after %s, longer than %s", elapsed, server.client.MaxCallDuration())
+	}
+	if calls := server.upstream.Calls("/api/v1/authorize"); calls != 1 {
+		t.Fatalf("authenticator called %d times, want 1", calls)
+	}
+}
+
+func TestRefreshUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		cached     bool
+		upstream   http.HandlerFunc
+		wantStatus int
+		wantVlan   uint16
+		wantNeg    bool
+	}{
+		{name: "unknown user accepted", upstream: acceptUser(20), wantStatus: http.StatusOK, wantVlan: 20},
+		{name: "unknown user rejected", upstream: answer(http.StatusUnauthorized, map[string]string{}), wantStatus: http.StatusUnauthorized, wantNeg: true},
+		{name: "unknown user, authenticator error", upstream: answer(http.StatusBadGateway, map[string]string{}), wantStatus: http.StatusUnauthorized},
+		{name: "stale user accepted", cached: true, upstream: acceptUser(20), wantStatus: http.StatusOK, wantVlan: 20},
+		{name: "stale user rejected", cached: true, upstream: answer(http.StatusNotFound, map[string]string{}), wantStatus: http.StatusUnauthorized, wantNeg: true},
+		{name: "stale user, authenticator error", cached: true, upstream: answer(http.StatusBadGateway, map[string]string{}), wantStatus: http.StatusOK, wantVlan: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{NegativeTTL: time.Minute}, map[string]http.HandlerFunc{
+				"/api/v1/authorize": test.upstream,
+			})
+			if test.cached {
+				if err := server.cache.AddUser(cache.User{Username: "alice", Password: "{clear}password", Mac: "aa:bb:cc:dd:ee:ff", VlanId: 10, Created: time.Now().Add(-2 * time.Hour)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if response := server.authorize(aliceRequest); response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+			user, found := server.cache.GetUser("alice", "aa:bb:cc:dd:ee:ff")
+			if test.wantVlan > 0 && (!found || user.VlanId != test.wantVlan) {
+				t.Fatalf("got cached user %v with VLAN %d, want VLAN %d", found, user.VlanId, test.wantVlan)
+			}
+			if test.wantNeg && found {
+				t.Fatal("refused user still cached")
+			}
+			if _, rejected := server.cache.GetNegative("alice", "aa:bb:cc:dd:ee:ff"); rejected != test.wantNeg {
+				t.Fatalf("got negative entry %v, want %v", rejected, test.wantNeg)
+			}
+			// A negative entry answers without the authenticator
+			if test.wantNeg {
+				server.authorize(aliceRequest)
+				if calls := server.upstream.Calls("/api/v1/authorize"); calls != 1 {
+					t.Fatalf("authenticator called %d times, want 1", calls)
+				}
+			}
+		})
+	}
+}
+
+func TestOfflineSkipsAuthenticator(t *testing.T) {
+	server := newTestServer(t, Configuration{}, cache.Configuration{}, map[string]http.HandlerFunc{
+		"/api/v1/authorize": answer(http.StatusBadGateway, map[string]string{}),
+	})
+	config := health.Configuration{FailureThreshold: 1}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	server.health = health.New(server.log, &config, func() error { return errors.New("down") })
+	if err := server.cache.AddUser(cache.User{Username: "alice", Password: "{clear}password", Mac: "aa:bb:cc:dd:ee:ff", VlanId: 10, Created: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	// The first failure takes the authenticator offline, the next requests are answered from cache only
+	for i := 0; i < 3; i++ {
+		if response := server.authorize(aliceRequest); response.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", response.Code, http.StatusOK)
+		}
+	}
+	if state := server.health.State(); state != health.Offline {
+		t.Fatalf("got state %s, want %s", state, health.Offline)
+	}
+	if calls := server.upstream.Calls("/api/v1/authorize"); calls != 1 {
+		t.Fatalf("authenticator called %d times while offline, want 1", calls)
+	}
+}
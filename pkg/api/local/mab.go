@@ -0,0 +1,119 @@
+package local
+
+import (
+	"errors"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/api/helpers"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshMab asks the authenticator for a MAB device, cached apart from the PSK devices.
+// Unknown devices accepted in the fallback VLAN are cached too, so they keep it while the authenticator is offline.
+func (s *Server) refreshMab(c *gin.Context, requestedDevice *binding.UserRequest, errorFunc gin.HandlerFunc) {
+	var upstreamErr error
+	mac := requestedDevice.Username
+	logger := s.log.WithFields(map[string]interface{}{
+		"src_mac": mac,
+		"src_ip":  requestedDevice.ClientIp,
+	})
+	if !s.health.Available() {
+		logger.Debug("Authenticator offline, skipping device lookup")
+		errorFunc(c)
+		return
+	}
+	defer func() {
+		s.reportUpstream(c, upstreamErr)
+	}()
+	device, err := s.client.GetMab(c.Request.Context(), requestedDevice)
+	if err != nil {
+		if errors.Is(err, client.UserNotFoundError) && s.config.MabFallbackVlan > 0 {
+			fallback := cache.Device{Mac: mac, Mab: true, Fallback: true, VlanId: s.config.MabFallbackVlan}
+			if err := s.cache.AddDevice(fallback); err != nil {
+				logger.Errorf("Cannot add device to cache: %s", err)
+			}
+			s.acceptMab(c, requestedDevice.ClientIp, fallback, audit.FallbackSource, logger)
+			return
+		}
+		if errors.Is(err, client.UserRejectedError) || errors.Is(err, client.UserNotFoundError) {
+			logger.Debugf("Device refused by authenticator: %s", err)
+			s.cache.EvictMabDevice(mac)
+			s.cache.AddMabNegative(mac, err.Error())
+			helpers.RadiusReject(c, logger, "Rejecting device")
+			return
+		}
+		logger.Errorf("Error with authenticator: %s", err)
+		upstreamErr = err
+		errorFunc(c)
+		return
+	}
+	logger.Trace("Adding device to cache")
+	if err := s.cache.AddDevice(cache.Device{
+		Mac:        mac,
+		Mab:        true,
+		VlanId:     device.VLAN,
+		Role:       device.Role,
+		Attributes: device.Attributes,
+	}); err != nil {
+		logger.Errorf("Cannot add device to cache: %s", err)
+	}
+	helpers.RadiusAcceptDevice(c, s.vendorProfile(requestedDevice.ClientIp), "", device.VLAN, device.Role, device.Attributes, logger)
+}
+
+// acceptMab answers with a MAB device, in the current fallback VLAN if it is unknown to the authenticator
+func (s *Server) acceptMab(c *gin.Context, nas string, device cache.Device, source string, logger *log.Entry) {
+	helpers.SetDecisionSource(c, source)
+	profile := s.vendorProfile(nas)
+	if device.Fallback {
+		helpers.RadiusAcceptDevice(c, profile, "", s.config.MabFallbackVlan, "", nil, logger, "Accepting unknown device in fallback VLAN %d", s.config.MabFallbackVlan)
+		return
+	}
+	helpers.RadiusAcceptDevice(c, profile, "", device.VlanId, device.Role, device.Attributes, logger)
+}
+
+func (s *Server) mabAuthorize(c *gin.Context, deviceRequest *binding.UserRequest) {
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":   deviceRequest.Username,
+		"src_ip": deviceRequest.ClientIp,
+	})
+	mac, err := radius.NormalizeMAC(deviceRequest.Username)
+	if err != nil {
+		helpers.RadiusReject(c, logger, "Rejecting MAB request with invalid MAC address %s", deviceRequest.Username)
+		return
+	}
+	deviceRequest.Username = mac
+	deviceRequest.ClientMac = mac
+	logger = s.log.WithFields(map[string]interface{}{
+		"src_mac": mac,
+		"src_ip":  deviceRequest.ClientIp,
+	})
+	cachedDevice, mustRefresh, found := s.cache.GetMabDeviceWithRefreshNeed(mac)
+	if found && cachedDevice.Fallback && s.config.MabFallbackVlan == 0 {
+		// The fallback VLAN was disabled since the device was cached
+		found = false
+	}
+	if !found {
+		if negative, rejected := s.cache.GetMabNegative(mac); rejected {
+			helpers.SetDecisionSource(c, audit.NegativeCacheSource)
+			helpers.RadiusReject(c, logger, "Rejecting device from negative cache: %s", negative.Reason)
+			return
+		}
+		logger.Trace("Device not in cache, refreshing")
+		s.refreshMab(c, deviceRequest, func(c *gin.Context) {
+			helpers.RadiusReject(c, logger, "Rejecting device")
+		})
+		return
+	}
+	if mustRefresh {
+		logger.Trace("Device in cache for a while, refreshing")
+		s.refreshMab(c, deviceRequest, func(c *gin.Context) {
+			s.acceptMab(c, deviceRequest.ClientIp, cachedDevice, audit.OfflineSource, logger)
+		})
+		return
+	}
+	s.acceptMab(c, deviceRequest.ClientIp, cachedDevice, s.cachedSource(), logger)
+}
@@ -0,0 +1,159 @@
+package local
+
+import (
+	"encoding/json"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var mabRequest = binding.UserRequest{
+	Username:      "AA-BB-CC-DD-EE-FF",
+	ClientIp:      "192.0.2.1",
+	VirtualServer: binding.MabVirtualServer,
+}
+
+// responseVlan returns the VLAN of an accept
+func responseVlan(t *testing.T, response *httptest.ResponseRecorder) uint16 {
+	t.Helper()
+	accept := struct {
+		VLAN uint16 `json:"reply:Tunnel-Private-Group-Id"`
+	}{}
+	if err := json.Unmarshal(response.Body.Bytes(), &accept); err != nil {
+		t.Fatalf("cannot decode accept %s: %s", response.Body.String(), err)
+	}
+	return accept.VLAN
+}
+
+func TestMabAuthorize(t *testing.T) {
+	tests := []struct {
+		name         string
+		fallbackVlan uint16
+		cached       *cache.Device
+		username     string
+		upstream     http.HandlerFunc
+		wantStatus   int
+		wantVlan     uint16
+		wantCalls    int
+		wantCached   bool
+		wantFallback bool
+		wantNeg      bool
+	}{
+		{
+			name:       "device accepted",
+			upstream:   answer(http.StatusOK, binding.UpstreamUserResponse{VLAN: 20}),
+			wantStatus: http.StatusOK,
+			wantVlan:   20,
+			wantCalls:  1,
+			wantCached: true,
+		},
+		{
+			name:       "invalid MAC address",
+			username:   "device",
+			upstream:   answer(http.StatusOK, binding.UpstreamUserResponse{VLAN: 20}),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown device",
+			upstream:   answer(http.StatusNotFound, map[string]string{}),
+			wantStatus: http.StatusUnauthorized,
+			wantCalls:  1,
+			wantNeg:    true,
+		},
+		{
+			name:         "unknown device in fallback VLAN",
+			fallbackVlan: 99,
+			upstream:     answer(http.StatusNotFound, map[string]string{}),
+			wantStatus:   http.StatusOK,
+			wantVlan:     99,
+			wantCalls:    1,
+			wantCached:   true,
+			wantFallback: true,
+		},
+		{
+			name:         "rejected device not in fallback VLAN",
+			fallbackVlan: 99,
+			upstream:     answer(http.StatusUnauthorized, map[string]string{}),
+			wantStatus:   http.StatusUnauthorized,
+			wantCalls:    1,
+			wantNeg:      true,
+		},
+		{
+			name:       "cached device",
+			cached:     &cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Mab: true, VlanId: 30},
+			upstream:   answer(http.StatusOK, binding.UpstreamUserResponse{VLAN: 20}),
+			wantStatus: http.StatusOK,
+			wantVlan:   30,
+			wantCached: true,
+		},
+		{
+			name:       "fallback disabled since caching",
+			cached:     &cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Mab: true, Fallback: true, VlanId: 99},
+			upstream:   answer(http.StatusOK, binding.UpstreamUserResponse{VLAN: 20}),
+			wantStatus: http.StatusOK,
+			wantVlan:   20,
+			wantCalls:  1,
+			wantCached: true,
+		},
+		{
+			name:       "stale device, authenticator error",
+			cached:     &cache.Device{Mac: "aa:bb:cc:dd:ee:ff", Mab: true, VlanId: 30, Created: time.Now().Add(-2 * time.Hour)},
+			upstream:   answer(http.StatusBadGateway, map[string]string{}),
+			wantStatus: http.StatusOK,
+			wantVlan:   30,
+			wantCalls:  1,
+			wantCached: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{MabFallbackVlan: test.fallbackVlan}, cache.Configuration{NegativeTTL: time.Minute}, map[string]http.HandlerFunc{
+				"/api/v1/mab": test.upstream,
+			})
+			if test.cached != nil {
+				if err := server.cache.AddDevice(*test.cached); err != nil {
+					t.Fatal(err)
+				}
+			}
+			request := mabRequest
+			if len(test.username) > 0 {
+				request.Username = test.username
+			}
+			response := server.authorize(request)
+			if response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+			if test.wantStatus == http.StatusOK {
+				if vlan := responseVlan(t, response); vlan != test.wantVlan {
+					t.Fatalf("got VLAN %d, want %d", vlan, test.wantVlan)
+				}
+			}
+			if calls := server.upstream.Calls("/api/v1/mab"); calls != test.wantCalls {
+				t.Fatalf("authenticator called %d times, want %d", calls, test.wantCalls)
+			}
+			device, _, found := server.cache.GetMabDeviceWithRefreshNeed("aa:bb:cc:dd:ee:ff")
+			if found != test.wantCached || device.Fallback != test.wantFallback {
+				t.Fatalf("got cached device %v with fallback %v, want %v with fallback %v", found, device.Fallback, test.wantCached, test.wantFallback)
+			}
+			// MAB devices are not PSK devices
+			if _, _, found := server.cache.GetDeviceWithRefreshNeed("aa:bb:cc:dd:ee:ff"); found {
+				t.Fatal("MAB device cached as PSK device")
+			}
+			if _, rejected := server.cache.GetMabNegative("aa:bb:cc:dd:ee:ff"); rejected != test.wantNeg {
+				t.Fatalf("got negative entry %v, want %v", rejected, test.wantNeg)
+			}
+			// A negative entry answers without the authenticator
+			if test.wantNeg {
+				if response := server.authorize(request); response.Code != http.StatusUnauthorized {
+					t.Fatalf("got status %d from negative cache, want %d", response.Code, http.StatusUnauthorized)
+				}
+				if calls := server.upstream.Calls("/api/v1/mab"); calls != test.wantCalls {
+					t.Fatalf("authenticator called %d times, want %d", calls, test.wantCalls)
+				}
+			}
+		})
+	}
+}
@@ -3,14 +3,21 @@ package local
 import (
 	"context"
 	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
 	"github.com/COSAE-FR/ripradius/pkg/local/cache"
 	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/local/coa"
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
 	"github.com/COSAE-FR/riputils/gin/ginlog"
 	"github.com/COSAE-FR/riputils/gin/token"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -25,20 +32,39 @@ type Server struct {
 	config   *Configuration
 	client   *client.Client
 	cache    *cache.Cache
+	health   *health.Monitor
 	log      *log.Entry
+	// users being refreshed in the background
+	refreshing  map[string]bool
+	refreshLock sync.Mutex
+	// concurrent upstream user lookups
+	users    *userFlight
+	sessions *session.Store
+	// dynamic authorization sender, disabled when nil
+	coa *coa.Sender
+	// authentication audit trail, disabled when nil
+	audit *audit.Log
+	// live events, disabled when nil
+	events *events.Bus
+	// Freeradius server certificate status provider
+	certificate func() *binding.CertificateStatus
 }
 
-func New(logger *log.Entry, config *Configuration, userCache *cache.Cache, upstreamClient *client.Client) (*Server, error) {
+func New(logger *log.Entry, config *Configuration, userCache *cache.Cache, upstreamClient *client.Client, monitor *health.Monitor, sessions *session.Store) (*Server, error) {
 	router := gin.New()
 	_ = router.SetTrustedProxies(nil)
 	srv := Server{
 		server: &http.Server{
 			Handler: router,
 		},
-		config: config,
-		client: upstreamClient,
-		cache:  userCache,
-		log:    logger.WithField("component", "api_server"),
+		config:     config,
+		client:     upstreamClient,
+		cache:      userCache,
+		health:     monitor,
+		sessions:   sessions,
+		log:        logger.WithField("component", "api_server"),
+		refreshing: make(map[string]bool),
+		users:      newUserFlight(),
 	}
 	router.Use(ginlog.Logger(srv.log), gin.Recovery())
 	router.GET("/api/v1/status", srv.status)
@@ -48,10 +74,48 @@ func New(logger *log.Entry, config *Configuration, userCache *cache.Cache, upstr
 		operational.Use(token.StaticTokenMiddleware(config.Token, srv.log))
 	}
 	operational.POST("/api/v1/authorize", srv.userAuthorize)
+	operational.GET("/api/v1/dynamic-client", srv.dynamicClient)
+	operational.POST("/api/v1/accounting", srv.accounting)
+	operational.POST("/api/v1/post-auth", srv.postAuth)
+	operational.GET("/api/v1/audit", srv.auditList)
+	operational.GET("/api/v1/events", srv.eventStream)
+	operational.GET("/api/v1/sessions", srv.sessionList)
+	operational.GET("/api/v1/sessions/:id", srv.sessionShow)
+	operational.POST("/api/v1/kick", srv.kick)
+	operational.GET("/api/v1/cache/users", srv.cacheList)
+	operational.DELETE("/api/v1/cache/users", srv.cacheEvict)
+	operational.DELETE("/api/v1/cache", srv.cacheFlush)
 	return &srv, nil
 }
 
+// SetCertificateStatus sets the provider of the Freeradius certificate status
+func (s *Server) SetCertificateStatus(provider func() *binding.CertificateStatus) {
+	s.certificate = provider
+}
+
+// SetCoASender sets the sender of CoA and Disconnect requests
+func (s *Server) SetCoASender(sender *coa.Sender) {
+	s.coa = sender
+}
+
+// SetAuditLog sets the log of the authentication decisions
+func (s *Server) SetAuditLog(auditLog *audit.Log) {
+	s.audit = auditLog
+}
+
+// SetEventBus sets the bus of the live events, its streams are closed when the server stops
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
+	s.server.RegisterOnShutdown(bus.Disconnect)
+}
+
 func (s *Server) Configure() error {
+	if err := s.config.TokenError(); err != nil {
+		return err
+	}
+	if err := s.config.SaveToken(); err != nil {
+		return err
+	}
 	var err error
 	s.listener, err = net.Listen("tcp4", fmt.Sprintf("%s:%d", s.config.IPAddress, s.config.Port))
 	if err != nil {
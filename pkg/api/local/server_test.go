@@ -0,0 +1,141 @@
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/creasty/defaults"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authenticator is a fake upstream authenticator, answering with the handler of each path
+type authenticator struct {
+	handlers map[string]http.HandlerFunc
+	calls    map[string]int
+	sync.Mutex
+}
+
+func (a *authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	a.calls[r.URL.Path]++
+	handler, found := a.handlers[r.URL.Path]
+	a.Unlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	handler(w, r)
+}
+
+// Calls returns the number of requests received on path
+func (a *authenticator) Calls(path string) int {
+	a.Lock()
+	defer a.Unlock()
+	return a.calls[path]
+}
+
+// answer returns a handler answering with status and body as JSON
+func answer(status int, body interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+// testServer is a local API server with its cache, sessions and upstream authenticator
+type testServer struct {
+	*Server
+	upstream *authenticator
+}
+
+func newTestServer(t *testing.T, config Configuration, cacheConfig cache.Configuration, handlers map[string]http.HandlerFunc) *testServer {
+	t.Helper()
+	logger := log.NewEntry(log.New())
+	logger.Logger.SetLevel(log.PanicLevel)
+	upstream := &authenticator{handlers: handlers, calls: make(map[string]int)}
+	httpServer := httptest.NewServer(upstream)
+	t.Cleanup(httpServer.Close)
+	clientConfig := client.Configuration{
+		Servers: []string{httpServer.URL},
+		Timeout: 200 * time.Millisecond,
+		Token:   "upstream token",
+	}
+	if err := clientConfig.Check(); err != nil {
+		t.Fatal(err)
+	}
+	clientConfig.Retries = 0
+	upstreamClient, err := client.New(clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheConfig.Check(); err != nil {
+		t.Fatal(err)
+	}
+	userCache, err := cache.New(logger, &cacheConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthConfig := health.Configuration{}
+	if err := healthConfig.Check(); err != nil {
+		t.Fatal(err)
+	}
+	sessionConfig := session.Configuration{}
+	if err := sessionConfig.Check(); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := session.New(logger, &sessionConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := defaults.Set(&config); err != nil {
+		t.Fatal(err)
+	}
+	server, err := New(logger, &config, userCache, upstreamClient, health.New(logger, &healthConfig, nil), sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{Server: server, upstream: upstream}
+}
+
+// serve sends a request to the API and returns the answer
+func (s *testServer) serve(method string, target string, body interface{}) *httptest.ResponseRecorder {
+	var content []byte
+	if body != nil {
+		content, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, target, bytes.NewReader(content))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *testServer) authorize(request binding.UserRequest) *httptest.ResponseRecorder {
+	return s.serve(http.MethodPost, "/api/v1/authorize", request)
+}
+
+// waitRefreshes waits for the background refreshes to end
+func (s *testServer) waitRefreshes(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		s.refreshLock.Lock()
+		pending := len(s.refreshing)
+		s.refreshLock.Unlock()
+		if pending == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("background refresh still running after %s", timeout)
+}
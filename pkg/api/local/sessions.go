@@ -0,0 +1,83 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSessionLimit = 100
+	maxSessionLimit     = 1000
+)
+
+func badQuery(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
+		"message": message,
+	})
+}
+
+func (s *Server) sessionList(c *gin.Context) {
+	filter := session.Filter{
+		Username: c.Query("username"),
+		Nas:      c.Query("nas"),
+	}
+	if mac := c.Query("mac"); len(mac) > 0 {
+		var valid bool
+		if filter.Mac, valid = radius.CanonicalMAC(mac); !valid {
+			badQuery(c, "invalid mac")
+			return
+		}
+	}
+	if vlan := c.Query("vlan"); len(vlan) > 0 {
+		id, err := strconv.ParseUint(vlan, 10, 16)
+		if err != nil {
+			badQuery(c, "invalid vlan")
+			return
+		}
+		filter.VLAN = uint16(id)
+	}
+	if active := c.Query("active"); len(active) > 0 {
+		value, err := strconv.ParseBool(active)
+		if err != nil {
+			badQuery(c, "invalid active")
+			return
+		}
+		filter.Active = &value
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		badQuery(c, "invalid offset")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSessionLimit)))
+	if err != nil || limit <= 0 {
+		badQuery(c, "invalid limit")
+		return
+	}
+	if limit > maxSessionLimit {
+		limit = maxSessionLimit
+	}
+	sessions := s.sessions.List(filter)
+	response := binding.SessionList{
+		Total:    len(sessions),
+		Offset:   offset,
+		Limit:    limit,
+		Sessions: session.Page(sessions, offset, limit),
+	}
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
+
+func (s *Server) sessionShow(c *gin.Context) {
+	found, ok := s.sessions.Get(c.Param("id"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, map[string]string{
+			"message": "session not found",
+		})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusOK, found)
+}
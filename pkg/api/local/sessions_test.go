@@ -0,0 +1,29 @@
+package local
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"net/http"
+	"testing"
+)
+
+func TestSessionListQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "no filter", wantStatus: http.StatusOK},
+		{name: "mac", query: "?mac=AA-BB-CC-DD-EE-FF", wantStatus: http.StatusOK},
+		{name: "invalid mac", query: "?mac=not-a-mac", wantStatus: http.StatusBadRequest},
+		{name: "invalid vlan", query: "?vlan=vlan10", wantStatus: http.StatusBadRequest},
+		{name: "invalid active", query: "?active=maybe", wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Configuration{}, cache.Configuration{}, nil)
+			if response := server.serve(http.MethodGet, "/api/v1/sessions"+test.query, nil); response.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.Code, test.wantStatus)
+			}
+		})
+	}
+}
@@ -2,13 +2,14 @@ package freeradius
 
 import (
 	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/pki"
 	"github.com/COSAE-FR/ripradius/pkg/utils"
 	"github.com/COSAE-FR/riputils/common"
 	"github.com/COSAE-FR/riputils/tls"
 	"github.com/creasty/defaults"
-	"io/ioutil"
 	"os/exec"
-	"strings"
+	"time"
 )
 
 // Configuration holds the parameters needed to manage a dedicated Freeradius daemon
@@ -36,11 +37,29 @@ type Configuration struct {
 	NoBundle        bool   `yaml:"no_bundle"`
 	Certificate     string `yaml:"certificate"`
 	Key             string `yaml:"key"`
-	ApiToken        string
-	ApiHost         string
-	ApiPort         uint32
-	EnableAdmin     bool   `yaml:"enable_admin"`
-	ClientNet       string `yaml:"client_net" validate:"isdefault|cidrv4"`
+	// File holding the passphrase of an encrypted key
+	KeyPassphraseFile string `yaml:"key_passphrase_file"`
+	// Report the certificate as expiring soon during this period before its end
+	CertificateExpiryWarning time.Duration        `yaml:"certificate_expiry_warning" default:"720h"`
+	CertificateInfo          *pki.CertificateInfo `yaml:"-"`
+	// Timeout of the Freeradius calls to the local API, the longest authenticator call plus one second by default
+	RestTimeout time.Duration `yaml:"rest_timeout"`
+	ApiToken    string
+	ApiHost     string
+	ApiPort     uint32
+	EnableAdmin bool `yaml:"enable_admin"`
+	// Per-device PSK authorizations (MAC authentication) on a dedicated port
+	EnablePsk bool   `yaml:"enable_psk"`
+	PskPort   uint32 `yaml:"psk_port" default:"1815"`
+	// MAC authentication bypass on a dedicated port
+	EnableMab bool   `yaml:"enable_mab"`
+	MabPort   uint32 `yaml:"mab_port" default:"1816"`
+	// Accounting listener, records are sent to the local API
+	EnableAccounting bool   `yaml:"enable_accounting"`
+	AccountingPort   uint32 `yaml:"accounting_port" default:"1813"`
+	// Do not post the authentication outcomes to the local API audit log
+	DisableAudit bool   `yaml:"disable_audit"`
+	ClientNet    string `yaml:"client_net" validate:"isdefault|cidrv4"`
 	// radiusd.conf tuning
 	// MaxRequestTime The maximum time (in seconds) to handle a request (5 to 120).
 	MaxRequestTime uint8 `yaml:"max_request_time" default:"30"`
@@ -75,6 +94,15 @@ func (c *Configuration) Check() error {
 	if len(c.Secret) == 0 && !c.EnableAdmin {
 		return fmt.Errorf("radius secret is mandatory")
 	}
+	if len(c.Secret) == 0 && c.EnablePsk {
+		return fmt.Errorf("radius secret is mandatory for PSK authorizations")
+	}
+	if len(c.Secret) == 0 && c.EnableAccounting {
+		return fmt.Errorf("radius secret is mandatory for accounting")
+	}
+	if len(c.Secret) == 0 && c.EnableMab {
+		return fmt.Errorf("radius secret is mandatory for MAC authentication bypass")
+	}
 	if len(c.RunDirectory) == 0 {
 		c.RunDirectory = utils.RunDirectory
 	}
@@ -88,39 +116,29 @@ func (c *Configuration) Check() error {
 	c.InterfaceNet = ifIP.String()
 	c.InterfaceIP = ifIP.IP.To4().String()
 	if len(c.CA) > 0 {
-		if !strings.Contains(c.CA, "BEGIN CERTIFICATE") {
-			if !common.FileExists(c.CA) {
-				return fmt.Errorf("ca is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.CA); err != nil {
-				return fmt.Errorf("cannot reqd CA file: %s", err)
-			} else {
-				c.CA = string(content)
-			}
+		ca, err := pki.LoadCertificates("ca", c.CA)
+		if err != nil {
+			return err
 		}
+		c.CA = ca
 	}
 	if len(c.Certificate) > 0 {
-		if !strings.Contains(c.Certificate, "BEGIN CERTIFICATE") {
-			if !common.FileExists(c.Certificate) {
-				return fmt.Errorf("certificate is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.Certificate); err != nil {
-				return fmt.Errorf("cannot reqd certificate file: %s", err)
-			} else {
-				c.Certificate = string(content)
-			}
+		certificate, err := pki.LoadCertificates("certificate", c.Certificate)
+		if err != nil {
+			return err
 		}
+		c.Certificate = certificate
 	}
 	if len(c.Key) > 0 {
-		if !strings.Contains(c.Key, "BEGIN RSA PRIVATE KEY") {
-			if !common.FileExists(c.Key) {
-				return fmt.Errorf("key is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.Key); err != nil {
-				return fmt.Errorf("cannot reqd key file: %s", err)
-			} else {
-				c.Key = string(content)
-			}
+		key, err := pki.LoadKey(c.Key, c.KeyPassphraseFile)
+		if err != nil {
+			return err
+		}
+		c.Key = key
+	}
+	if len(c.Certificate) > 0 && len(c.Key) > 0 {
+		if err := pki.CheckKeyPair(c.Certificate, c.Key); err != nil {
+			return err
 		}
 	}
 	if len(c.Key) == 0 || len(c.Certificate) == 0 {
@@ -130,9 +148,41 @@ func (c *Configuration) Check() error {
 		}
 		c.Certificate = string(cert)
 		c.Key = string(key)
+		c.CertificateInfo, err = pki.DescribeCertificate(c.Certificate)
+		if err != nil {
+			return fmt.Errorf("cannot parse self-signed certificate for Freeradius server: %w", err)
+		}
+	} else if err := c.ValidateCertificate(); err != nil {
+		return err
 	}
 	if err := defaults.Set(c); err != nil {
 		return err
 	}
 	return nil
 }
+
+// ValidateCertificate checks the server certificate against the CA and stores its description
+func (c *Configuration) ValidateCertificate() error {
+	info, err := pki.ValidateServerCertificate(c.Certificate, c.CA, time.Now())
+	if err != nil {
+		return err
+	}
+	c.CertificateInfo = info
+	return nil
+}
+
+// CertificateStatus returns the server certificate validity, for status output
+func (c *Configuration) CertificateStatus() *binding.CertificateStatus {
+	if c.CertificateInfo == nil {
+		return nil
+	}
+	expiresIn := time.Until(c.CertificateInfo.NotAfter)
+	return &binding.CertificateStatus{
+		Subject:      c.CertificateInfo.Subject,
+		Issuer:       c.CertificateInfo.Issuer,
+		NotAfter:     c.CertificateInfo.NotAfter,
+		ExpiresIn:    int64(expiresIn.Seconds()),
+		ExpiringSoon: expiresIn < c.CertificateExpiryWarning,
+		Warnings:     c.CertificateInfo.Warnings,
+	}
+}
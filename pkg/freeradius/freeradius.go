@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"time"
 )
 
 type Freeradius struct {
@@ -18,10 +19,19 @@ type Freeradius struct {
 }
 
 func New(logger *log.Entry, config *Configuration) (*Freeradius, error) {
-	return &Freeradius{
+	f := &Freeradius{
 		config: config,
 		log:    logger.WithField("component", "freeradius"),
-	}, nil
+	}
+	if config.CertificateInfo != nil {
+		for _, warning := range config.CertificateInfo.Warnings {
+			f.log.Warnf("Server certificate %s: %s", config.CertificateInfo.Subject, warning)
+		}
+		if time.Until(config.CertificateInfo.NotAfter) < config.CertificateExpiryWarning {
+			f.log.Warnf("Server certificate %s expires on %s", config.CertificateInfo.Subject, config.CertificateInfo.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return f, nil
 }
 
 func (f *Freeradius) openRadiusLogFile() error {
@@ -38,11 +38,18 @@ type TemplatesConfiguration struct {
 	ApiToken                   string
 	ApiAuthorizePath           string
 	ApiDynamicPath             string
+	ApiAccountingPath          string
+	ApiPostAuthPath            string
+	ApiTimeout                 string
+	Audit                      bool
 	FreeradiusChangeUser       bool
 	FreeRadiusUser             string
 	FreeRadiusGroup            string
 	ListenAddress              string
 	ListenPort                 uint32
+	PskPort                    uint32
+	MabPort                    uint32
+	AccountingPort             uint32
 	ClientNet                  string
 	PrefixDirectory            string
 	MaxRequestTime             uint8
@@ -183,11 +190,18 @@ func (f *Freeradius) prepareConfiguration() error {
 		ApiServer:               fmt.Sprintf("http://%s:%d", f.config.ApiHost, f.config.ApiPort),
 		ApiAuthorizePath:        "/api/v1/authorize",
 		ApiDynamicPath:          "/api/v1/dynamic-client",
+		ApiAccountingPath:       "/api/v1/accounting",
+		ApiPostAuthPath:         "/api/v1/post-auth",
+		ApiTimeout:              strconv.FormatFloat(f.config.RestTimeout.Seconds(), 'f', 1, 64),
+		Audit:                   !f.config.DisableAudit,
 		FreeradiusChangeUser:    userId != "0",
 		FreeRadiusUser:          userName,
 		FreeRadiusGroup:         group,
 		ListenAddress:           listenIP,
 		ListenPort:              f.config.Port,
+		PskPort:                 f.config.PskPort,
+		MabPort:                 f.config.MabPort,
+		AccountingPort:          f.config.AccountingPort,
 		ClientNet:               clientNet,
 		PrefixDirectory:         prefixDir,
 		MaxRequestTime:          f.config.MaxRequestTime,
@@ -235,6 +249,24 @@ func (f *Freeradius) prepareConfiguration() error {
 	if err = writeTemplateFile(configs, "rest.tmpl", path.Join(configurationBase, "mods-enabled"), templatesConfig); err != nil {
 		return err
 	}
+	if err = writeTemplateFile(configs, "post-auth.tmpl", path.Join(configurationBase, "policy.d"), templatesConfig); err != nil {
+		return err
+	}
+	if f.config.EnableAccounting {
+		if err = writeTemplateFile(configs, "accounting.tmpl", path.Join(configurationBase, "sites-enabled"), templatesConfig); err != nil {
+			return err
+		}
+	}
+	if f.config.EnableMab {
+		if err = writeTemplateFile(configs, "mab.tmpl", path.Join(configurationBase, "sites-enabled"), templatesConfig); err != nil {
+			return err
+		}
+	}
+	if f.config.EnablePsk {
+		if err = writeTemplateFile(configs, "psk.tmpl", path.Join(configurationBase, "sites-enabled"), templatesConfig); err != nil {
+			return err
+		}
+	}
 	if f.config.EnableAdmin {
 		if err = writeTemplateFile(configs, "dynamic-clients.tmpl", path.Join(configurationBase, "sites-enabled"), templatesConfig); err != nil {
 			return err
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication results
+const (
+	AcceptResult = "accept"
+	RejectResult = "reject"
+)
+
+// Decision sources
+const (
+	// AuthenticatorSource is a fresh authenticator answer
+	AuthenticatorSource = "authenticator"
+	// CacheSource is a cached answer
+	CacheSource = "cache"
+	// OfflineSource is a cached answer while the authenticator is unreachable
+	OfflineSource = "offline"
+	// NegativeCacheSource is a reject from the negative cache
+	NegativeCacheSource = "negative_cache"
+	// FallbackSource is the MAB fallback VLAN for unknown devices
+	FallbackSource = "fallback"
+	// FreeradiusSource is a Freeradius outcome without local decision, like an EAP failure before authorize
+	FreeradiusSource = "freeradius"
+)
+
+// Decision is the answer of the local API to an authorize request
+type Decision struct {
+	Result string
+	Source string
+	VLAN   uint16
+	Role   string
+	Reason string
+}
+
+// Entry is an authentication outcome
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Username      string    `json:"username"`
+	Mac           string    `json:"mac,omitempty"`
+	Nas           string    `json:"nas"`
+	Ssid          string    `json:"ssid,omitempty"`
+	VirtualServer string    `json:"virtual_server,omitempty"`
+	VLAN          uint16    `json:"vlan,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	// Freeradius outcome, accept or reject
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+	Source string `json:"source"`
+	// Local decision, different from the result when Freeradius rejects an accepted user
+	Decision string `json:"decision,omitempty"`
+}
+
+// Filter selects entries, empty fields match every entry
+type Filter struct {
+	Username string
+	// Canonical MAC address
+	Mac    string
+	Nas    string
+	Result string
+	Source string
+	Since  time.Time
+}
+
+// Match reports if the entry is selected by the filter
+func (f Filter) Match(entry Entry) bool {
+	if len(f.Username) > 0 && !strings.EqualFold(f.Username, entry.Username) {
+		return false
+	}
+	if len(f.Mac) > 0 && f.Mac != entry.Mac {
+		return false
+	}
+	if len(f.Nas) > 0 && f.Nas != entry.Nas {
+		return false
+	}
+	if len(f.Result) > 0 && f.Result != entry.Result {
+		return false
+	}
+	if len(f.Source) > 0 && f.Source != entry.Source {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+type pendingDecision struct {
+	Decision
+	time time.Time
+}
+
+// Log joins the authorize decisions with the Freeradius outcomes, writes them as JSON lines and keeps the latest in memory
+type Log struct {
+	config    *Configuration
+	writer    io.WriteCloser
+	entries   []Entry
+	next      int
+	decisions map[string]pendingDecision
+	log       *log.Entry
+	sync.Mutex
+}
+
+func getDecisionKey(username string, mac string) string {
+	return fmt.Sprintf("%s|%s", strings.ToLower(username), strings.ToLower(mac))
+}
+
+func New(logger *log.Entry, config *Configuration) (*Log, error) {
+	audit := &Log{
+		config:    config,
+		entries:   make([]Entry, 0, config.BufferSize),
+		decisions: make(map[string]pendingDecision),
+		log:       logger.WithField("component", "audit"),
+	}
+	if len(config.Path) > 0 {
+		audit.writer = &lumberjack.Logger{
+			Filename:   config.Path,
+			MaxSize:    config.MaxSize,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     config.MaxAge,
+			Compress:   config.Compress,
+		}
+	}
+	return audit, nil
+}
+
+// Decide records the answer to an authorize request until the Freeradius outcome
+func (l *Log) Decide(username string, mac string, decision Decision) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	for key, pending := range l.decisions {
+		if now.Sub(pending.time) > l.config.DecisionTTL {
+			delete(l.decisions, key)
+		}
+	}
+	l.decisions[getDecisionKey(username, mac)] = pendingDecision{Decision: decision, time: now}
+}
+
+// Record completes the entry with the pending decision of the user, writes it and returns it
+func (l *Log) Record(entry Entry) Entry {
+	l.Lock()
+	defer l.Unlock()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	key := getDecisionKey(entry.Username, entry.Mac)
+	entry.Source = FreeradiusSource
+	if pending, found := l.decisions[key]; found && entry.Time.Sub(pending.time) <= l.config.DecisionTTL {
+		delete(l.decisions, key)
+		entry.Source = pending.Source
+		entry.Decision = pending.Result
+		if entry.Result == AcceptResult {
+			if entry.VLAN == 0 {
+				entry.VLAN = pending.VLAN
+			}
+			entry.Role = pending.Role
+		}
+		if len(entry.Reason) == 0 {
+			entry.Reason = pending.Reason
+		}
+	}
+	if len(l.entries) < l.config.BufferSize {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+	}
+	l.next = (l.next + 1) % l.config.BufferSize
+	if l.writer != nil {
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = l.writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			l.log.Errorf("Cannot write audit entry to %s: %s", l.config.Path, err)
+		}
+	}
+	return entry
+}
+
+// List returns the entries in memory selected by the filter, the most recent first
+func (l *Log) List(filter Filter) []Entry {
+	l.Lock()
+	defer l.Unlock()
+	entries := make([]Entry, 0)
+	for i := 1; i <= len(l.entries); i++ {
+		entry := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Stop closes the audit file
+func (l *Log) Stop() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.writer == nil {
+		return nil
+	}
+	return l.writer.Close()
+}
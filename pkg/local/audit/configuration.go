@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"time"
+)
+
+type Configuration struct {
+	// JSON lines file, entries are only kept in memory when empty
+	Path string `yaml:"path"`
+	// Rotate the file beyond this size in megabytes, keeping at most max_backups files for max_age days
+	MaxSize    int  `yaml:"max_size" default:"10"`
+	MaxBackups int  `yaml:"max_backups" default:"5"`
+	MaxAge     int  `yaml:"max_age" default:"30"`
+	Compress   bool `yaml:"compress"`
+	// Latest entries kept in memory for the API
+	BufferSize int `yaml:"buffer_size" default:"1000"`
+	// Authorize decisions wait this long for the Freeradius outcome
+	DecisionTTL time.Duration `yaml:"decision_ttl" default:"1m"`
+}
+
+func (c *Configuration) Check() error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	if c.BufferSize <= 0 || c.MaxSize <= 0 {
+		return fmt.Errorf("audit buffer and file sizes must be positive")
+	}
+	if c.DecisionTTL <= 0 {
+		return fmt.Errorf("audit decision TTL must be positive")
+	}
+	return nil
+}
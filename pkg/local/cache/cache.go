@@ -1,9 +1,11 @@
 package cache
 
 import (
+	"crypto/cipher"
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"github.com/COSAE-FR/riputils/cache"
 	log "github.com/sirupsen/logrus"
 	"strings"
@@ -11,11 +13,60 @@ import (
 	"time"
 )
 
+var MalformedMacError = errors.New("malformed MAC address")
+
 type User struct {
-	Username string
-	Password string
-	Mac      string
-	VlanId   uint16
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Mac      string `json:"mac"`
+	VlanId   uint16 `json:"vlan"`
+	Role     string `json:"role,omitempty"`
+	// Other reply attributes
+	Attributes radius.Attributes `json:"attributes,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// Negative is a user rejected or unknown to the authenticator
+type Negative struct {
+	Username string    `json:"username"`
+	Mac      string    `json:"mac"`
+	Reason   string    `json:"reason"`
+	Created  time.Time `json:"created"`
+}
+
+// Admin is a management login, cached per NAS
+type Admin struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Nas      string `json:"nas"`
+	Class    string `json:"class"`
+	// Privilege attributes
+	Attributes radius.Attributes `json:"attributes,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// Client is a dynamic RADIUS client (NAS) resolved by the authenticator
+type Client struct {
+	IP        string    `json:"ip"`
+	Shortname string    `json:"shortname"`
+	Secret    string    `json:"secret"`
+	Server    string    `json:"server"`
+	Created   time.Time `json:"created"`
+}
+
+// Device is a device authorized by its MAC address, with its own PSK or by MAC authentication bypass
+type Device struct {
+	Mac string `json:"mac"`
+	Psk string `json:"psk"`
+	// MAC authentication bypass devices are cached apart from the PSK ones
+	Mab bool `json:"mab,omitempty"`
+	// Device unknown to the authenticator, accepted in the MAB fallback VLAN
+	Fallback bool   `json:"fallback,omitempty"`
+	VlanId   uint16 `json:"vlan"`
+	Role     string `json:"role,omitempty"`
+	// Other reply attributes
+	Attributes radius.Attributes `json:"attributes,omitempty"`
+	Created    time.Time         `json:"created"`
 }
 
 // Status provides statistics for cache
@@ -25,19 +76,84 @@ type Status struct {
 	Added   int  `json:"added"`
 	Evicted int  `json:"evicted"`
 	Entries int  `json:"entries"`
+	Clients int  `json:"clients"`
+	Admins  int  `json:"admins"`
+	Devices int  `json:"devices"`
 	Offline bool `json:"offline"`
+	// Negative cache
+	NegativeHits    int `json:"negative_hits"`
+	NegativeMisses  int `json:"negative_misses"`
+	NegativeEntries int `json:"negative_entries"`
 }
 
+// Cache changes, reported to the notifier
+const (
+	AddedAction    = "added"
+	EvictedAction  = "evicted"
+	NegativeAction = "negative"
+	FlushedAction  = "flushed"
+)
+
+// Notifier is called on user and device cache changes, with empty username or MAC when not applicable
+type Notifier func(action string, username string, mac string)
+
 type Cache struct {
 	cache   cache.Cache
-	config  *Configuration
-	offline bool
-	log     *log.Entry
+	clients cache.Cache
+	admins  cache.Cache
+	devices cache.Cache
+	// negative is nil when negative caching is disabled
+	negative cache.Cache
+	config   *Configuration
+	aead     cipher.AEAD
+	offline  bool
+	notifier Notifier
+	done     chan bool
+	log      *log.Entry
 	sync.Mutex
 }
 
+// canonicalMac returns the cache form of a MAC address, so every NAS format gives the same key
+func canonicalMac(mac string) (string, error) {
+	canonical, valid := radius.CanonicalMAC(mac)
+	if !valid {
+		return "", MalformedMacError
+	}
+	return canonical, nil
+}
+
+// userMac returns the cache form of a user MAC address, empty when missing or malformed
+func userMac(mac string) string {
+	canonical, _ := canonicalMac(mac)
+	return canonical
+}
+
 func getUserKey(username string, mac string) string {
-	return fmt.Sprintf("user|%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%s", strings.ToLower(username), strings.ToLower(mac)))))
+	return fmt.Sprintf("user|%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%s", strings.ToLower(username), userMac(mac)))))
+}
+
+// UserKey returns the cache key of a user/MAC pair
+func UserKey(username string, mac string) string {
+	return getUserKey(username, mac)
+}
+
+func getClientKey(ip string) string {
+	return fmt.Sprintf("client|%s", strings.ToLower(ip))
+}
+
+func getAdminKey(username string, nas string) string {
+	return fmt.Sprintf("admin|%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%s", strings.ToLower(username), strings.ToLower(nas)))))
+}
+
+func getDeviceKey(mac string, mab bool) (string, error) {
+	canonical, err := canonicalMac(mac)
+	if err != nil {
+		return "", err
+	}
+	if mab {
+		return fmt.Sprintf("mab|%s", canonical), nil
+	}
+	return fmt.Sprintf("device|%s", canonical), nil
 }
 
 func New(logger *log.Entry, config *Configuration) (*Cache, error) {
@@ -47,23 +163,143 @@ func New(logger *log.Entry, config *Configuration) (*Cache, error) {
 		cacheLogger.Errorf("Cannot create cache backend: %s", err)
 		return nil, err
 	}
-	return &Cache{
-		cache:  c,
-		config: config,
-		log:    cacheLogger,
-	}, nil
+	clients, err := cache.New(cache.MaxKeys(config.ClientMaxSize), cache.TTL(config.ClientTTL), cache.LRU())
+	if err != nil {
+		cacheLogger.Errorf("Cannot create client cache backend: %s", err)
+		return nil, err
+	}
+	admins, err := cache.New(cache.MaxKeys(config.AdminMaxSize), cache.TTL(config.AdminTTL), cache.LRU())
+	if err != nil {
+		cacheLogger.Errorf("Cannot create admin cache backend: %s", err)
+		return nil, err
+	}
+	devices, err := cache.New(cache.MaxKeys(config.DeviceMaxSize), cache.TTL(config.TTL), cache.LRU())
+	if err != nil {
+		cacheLogger.Errorf("Cannot create device cache backend: %s", err)
+		return nil, err
+	}
+	var negative cache.Cache
+	if config.NegativeTTL > 0 {
+		negative, err = cache.New(cache.MaxKeys(config.NegativeMaxSize), cache.TTL(config.NegativeTTL), cache.LRU())
+		if err != nil {
+			cacheLogger.Errorf("Cannot create negative cache backend: %s", err)
+			return nil, err
+		}
+	}
+	aead, persistentKey, err := newCipher(config)
+	if err != nil {
+		cacheLogger.Errorf("Cannot create cache cipher: %s", err)
+		return nil, err
+	}
+	if !persistentKey && len(config.Path) > 0 {
+		cacheLogger.Warn("No cache key file nor RADIUS secret, the cache snapshot will not be readable after a restart")
+	}
+	userCache := &Cache{
+		cache:    c,
+		clients:  clients,
+		admins:   admins,
+		devices:  devices,
+		negative: negative,
+		config:   config,
+		aead:     aead,
+		log:      cacheLogger,
+	}
+	if len(config.Path) > 0 {
+		if err := userCache.load(); err != nil {
+			cacheLogger.Errorf("Cannot load cache snapshot %s: %s", config.Path, err)
+		}
+	}
+	return userCache, nil
+}
+
+// SetNotifier sets the function called on user and device cache changes
+func (c *Cache) SetNotifier(notifier Notifier) {
+	c.notifier = notifier
+}
+
+func (c *Cache) notify(action string, username string, mac string) {
+	if c.notifier != nil {
+		c.notifier(action, username, mac)
+	}
+}
+
+// Start periodically writes the cache snapshot, if configured
+func (c *Cache) Start() error {
+	if len(c.config.Path) == 0 || c.done != nil {
+		return nil
+	}
+	c.done = make(chan bool)
+	go func(done chan bool) {
+		tick := time.NewTicker(c.config.SaveInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				if err := c.save(); err != nil {
+					c.log.Errorf("Cannot write cache snapshot %s: %s", c.config.Path, err)
+				}
+			}
+		}
+	}(c.done)
+	return nil
+}
+
+// Stop writes a last cache snapshot, if configured
+func (c *Cache) Stop() error {
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+	if len(c.config.Path) == 0 {
+		return nil
+	}
+	return c.save()
+}
+
+// entryAge returns the age of a cached entry, from its creation time when known.
+// Entries restored from a snapshot are younger in the backend than in reality.
+func entryAge(created time.Time, backendAge time.Duration) time.Duration {
+	if created.IsZero() {
+		return backendAge
+	}
+	return time.Since(created)
+}
+
+func (c *Cache) expired(age time.Duration, ttl time.Duration, offlineTTL time.Duration) bool {
+	c.Lock()
+	offline := c.offline
+	c.Unlock()
+	if offline {
+		ttl = offlineTTL
+	}
+	return ttl > 0 && age > ttl
 }
 
 func (c *Cache) Status() Status {
+	c.Lock()
+	offline := c.offline
+	c.Unlock()
 	stats := c.cache.Stat()
-	return Status{
+	status := Status{
 		Hits:    stats.Hits,
 		Misses:  stats.Misses,
 		Added:   stats.Added,
 		Evicted: stats.Evicted,
 		Entries: c.cache.Len(),
-		Offline: c.offline,
+		Clients: c.clients.Len(),
+		Admins:  c.admins.Len(),
+		Devices: c.devices.Len(),
+		Offline: offline,
 	}
+	if c.negative != nil {
+		negativeStats := c.negative.Stat()
+		status.NegativeHits = negativeStats.Hits
+		status.NegativeMisses = negativeStats.Misses
+		status.NegativeEntries = c.negative.Len()
+	}
+	return status
 }
 
 func (c *Cache) SetOffline() {
@@ -71,6 +307,9 @@ func (c *Cache) SetOffline() {
 	defer c.Unlock()
 	c.log.Trace("Setting cache offline")
 	c.cache.ChangeTTL(c.config.OfflineTTL)
+	c.clients.ChangeTTL(c.config.OfflineTTL)
+	c.admins.ChangeTTL(c.config.AdminOfflineTTL)
+	c.devices.ChangeTTL(c.config.OfflineTTL)
 	c.offline = true
 }
 
@@ -79,6 +318,9 @@ func (c *Cache) SetOnline() {
 	defer c.Unlock()
 	c.log.Trace("Setting cache online")
 	c.cache.ChangeTTL(c.config.TTL)
+	c.clients.ChangeTTL(c.config.ClientTTL)
+	c.admins.ChangeTTL(c.config.AdminTTL)
+	c.devices.ChangeTTL(c.config.TTL)
 	c.offline = false
 }
 
@@ -106,6 +348,17 @@ func (c *Cache) GetUserWithAge(username string, mac string) (User, time.Duration
 		logger.Error("Cannot parse cached entry")
 		return User{}, 0, ok
 	}
+	age = entryAge(user.Created, age)
+	if c.expired(age, c.config.TTL, c.config.OfflineTTL) {
+		logger.Trace("Entry expired")
+		return User{}, 0, false
+	}
+	password, err := c.open(user.Password)
+	if err != nil {
+		logger.Errorf("Cannot decrypt cached entry: %s", err)
+		return User{}, 0, false
+	}
+	user.Password = password
 	return user, age, true
 }
 
@@ -139,6 +392,420 @@ func (c *Cache) AddUser(user User) error {
 		}).Error("Cache is not ready")
 		return errors.New("cache is not ready")
 	}
-	c.cache.Set(getUserKey(user.Username, user.Mac), user)
+	if user.Created.IsZero() {
+		user.Created = time.Now()
+	}
+	if c.config.NTHash {
+		user.Password = ntHash(user.Password)
+	}
+	password, err := c.seal(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = password
+	key := getUserKey(user.Username, user.Mac)
+	if c.negative != nil {
+		c.negative.Invalidate(key)
+	}
+	c.cache.Set(key, user)
+	c.notify(AddedAction, user.Username, userMac(user.Mac))
 	return nil
 }
+
+func (c *Cache) GetDeviceWithRefreshNeed(mac string) (Device, bool, bool) {
+	return c.getDevice(mac, false)
+}
+
+// GetMabDeviceWithRefreshNeed returns a device authorized by MAC authentication bypass
+func (c *Cache) GetMabDeviceWithRefreshNeed(mac string) (Device, bool, bool) {
+	return c.getDevice(mac, true)
+}
+
+func (c *Cache) getDevice(mac string, mab bool) (Device, bool, bool) {
+	logger := c.log.WithField("src_mac", mac)
+	if c.devices == nil {
+		logger.Error("Device cache is not ready")
+		return Device{}, true, false
+	}
+	key, err := getDeviceKey(mac, mab)
+	if err != nil {
+		logger.Debug("Malformed device MAC address")
+		return Device{}, true, false
+	}
+	entry, age, found := c.devices.GetWithAge(key)
+	if !found {
+		logger.Trace("Device not in cache")
+		return Device{}, true, false
+	}
+	device, ok := entry.(Device)
+	if !ok {
+		logger.Error("Cannot parse cached device")
+		return Device{}, true, false
+	}
+	age = entryAge(device.Created, age)
+	if c.expired(age, c.config.TTL, c.config.OfflineTTL) {
+		logger.Trace("Device expired")
+		return Device{}, true, false
+	}
+	psk, err := c.open(device.Psk)
+	if err != nil {
+		logger.Errorf("Cannot decrypt cached device: %s", err)
+		return Device{}, true, false
+	}
+	device.Psk = psk
+	return device, age > c.config.RefreshTTL, true
+}
+
+func (c *Cache) AddDevice(device Device) error {
+	if c.devices == nil {
+		c.log.WithField("src_mac", device.Mac).Error("Device cache is not ready")
+		return errors.New("device cache is not ready")
+	}
+	key, err := getDeviceKey(device.Mac, device.Mab)
+	if err != nil {
+		return err
+	}
+	if device.Created.IsZero() {
+		device.Created = time.Now()
+	}
+	psk, err := c.seal(device.Psk)
+	if err != nil {
+		return err
+	}
+	device.Psk = psk
+	if c.negative != nil {
+		c.negative.Invalidate(key)
+	}
+	c.devices.Set(key, device)
+	c.notify(AddedAction, "", userMac(device.Mac))
+	return nil
+}
+
+// EvictDevice removes a device from the cache
+func (c *Cache) EvictDevice(mac string) bool {
+	return c.evictDevice(mac, false)
+}
+
+// EvictMabDevice removes a MAC authentication bypass device from the cache, with its last reject
+func (c *Cache) EvictMabDevice(mac string) bool {
+	return c.evictDevice(mac, true)
+}
+
+func (c *Cache) evictDevice(mac string, mab bool) bool {
+	if c.devices == nil {
+		return false
+	}
+	key, err := getDeviceKey(mac, mab)
+	if err != nil {
+		return false
+	}
+	if c.negative != nil {
+		c.negative.Invalidate(key)
+	}
+	if !c.devices.Has(key) {
+		return false
+	}
+	c.devices.Invalidate(key)
+	c.log.WithField("src_mac", mac).Debug("Device evicted from cache")
+	c.notify(EvictedAction, "", userMac(mac))
+	return true
+}
+
+// AllowOfflineAdmin reports if cached management logins can be used while the authenticator is offline
+func (c *Cache) AllowOfflineAdmin() bool {
+	return c.config.AdminOffline
+}
+
+func (c *Cache) GetClientWithRefreshNeed(ip string) (Client, bool, bool) {
+	logger := c.log.WithField("src_ip", ip)
+	if c.clients == nil {
+		logger.Error("Client cache is not ready")
+		return Client{}, true, false
+	}
+	entry, age, found := c.clients.GetWithAge(getClientKey(ip))
+	if !found {
+		logger.Trace("Client not in cache")
+		return Client{}, true, false
+	}
+	client, ok := entry.(Client)
+	if !ok {
+		logger.Error("Cannot parse cached client")
+		return Client{}, true, false
+	}
+	age = entryAge(client.Created, age)
+	if c.expired(age, c.config.ClientTTL, c.config.OfflineTTL) {
+		logger.Trace("Client expired")
+		return Client{}, true, false
+	}
+	secret, err := c.open(client.Secret)
+	if err != nil {
+		logger.Errorf("Cannot decrypt cached client: %s", err)
+		return Client{}, true, false
+	}
+	client.Secret = secret
+	return client, age > c.config.ClientRefreshTTL, true
+}
+
+func (c *Cache) AddClient(client Client) error {
+	if c.clients == nil {
+		c.log.WithField("src_ip", client.IP).Error("Client cache is not ready")
+		return errors.New("client cache is not ready")
+	}
+	if client.Created.IsZero() {
+		client.Created = time.Now()
+	}
+	secret, err := c.seal(client.Secret)
+	if err != nil {
+		return err
+	}
+	client.Secret = secret
+	c.clients.Set(getClientKey(client.IP), client)
+	return nil
+}
+
+// RemoveClient forgets a NAS unknown to the authenticator
+func (c *Cache) RemoveClient(ip string) {
+	if c.clients == nil {
+		return
+	}
+	c.clients.Invalidate(getClientKey(ip))
+}
+
+func (c *Cache) GetAdminWithRefreshNeed(username string, nas string) (Admin, bool, bool) {
+	logger := c.log.WithFields(map[string]interface{}{
+		"user":   username,
+		"src_ip": nas,
+	})
+	if c.admins == nil {
+		logger.Error("Admin cache is not ready")
+		return Admin{}, true, false
+	}
+	entry, age, found := c.admins.GetWithAge(getAdminKey(username, nas))
+	if !found {
+		logger.Trace("Admin not in cache")
+		return Admin{}, true, false
+	}
+	admin, ok := entry.(Admin)
+	if !ok {
+		logger.Error("Cannot parse cached admin")
+		return Admin{}, true, false
+	}
+	age = entryAge(admin.Created, age)
+	if c.expired(age, c.config.AdminTTL, c.config.AdminOfflineTTL) {
+		logger.Trace("Admin expired")
+		return Admin{}, true, false
+	}
+	password, err := c.open(admin.Password)
+	if err != nil {
+		logger.Errorf("Cannot decrypt cached admin: %s", err)
+		return Admin{}, true, false
+	}
+	admin.Password = password
+	return admin, age > c.config.AdminRefreshTTL, true
+}
+
+func (c *Cache) AddAdmin(admin Admin) error {
+	if c.admins == nil {
+		c.log.WithFields(map[string]interface{}{
+			"user":   admin.Username,
+			"src_ip": admin.Nas,
+		}).Error("Admin cache is not ready")
+		return errors.New("admin cache is not ready")
+	}
+	if admin.Created.IsZero() {
+		admin.Created = time.Now()
+	}
+	if c.config.NTHash {
+		admin.Password = ntHash(admin.Password)
+	}
+	password, err := c.seal(admin.Password)
+	if err != nil {
+		return err
+	}
+	admin.Password = password
+	c.admins.Set(getAdminKey(admin.Username, admin.Nas), admin)
+	return nil
+}
+
+func (c *Cache) RemoveAdmin(username string, nas string) {
+	if c.admins == nil {
+		return
+	}
+	c.admins.Invalidate(getAdminKey(username, nas))
+}
+
+// redact hides a cached password, keeping its Password-With-Header prefix
+func (c *Cache) redact(password string) string {
+	plain, err := c.open(password)
+	if err != nil {
+		return "********"
+	}
+	if strings.HasPrefix(plain, "{") {
+		if end := strings.Index(plain, "}"); end > 0 {
+			return plain[:end+1] + "********"
+		}
+	}
+	return "********"
+}
+
+// ListUsers returns the cached users with redacted passwords
+func (c *Cache) ListUsers() []User {
+	var users []User
+	if c.cache == nil {
+		return users
+	}
+	for _, key := range c.cache.Keys() {
+		entry, found := c.cache.Peek(key)
+		if !found {
+			continue
+		}
+		user, ok := entry.(User)
+		if !ok {
+			continue
+		}
+		user.Password = c.redact(user.Password)
+		users = append(users, user)
+	}
+	return users
+}
+
+// EvictUser removes a user/MAC pair from the cache
+func (c *Cache) EvictUser(username string, mac string) bool {
+	if c.cache == nil {
+		return false
+	}
+	key := getUserKey(username, mac)
+	if c.negative != nil {
+		c.negative.Invalidate(key)
+	}
+	if !c.cache.Has(key) {
+		return false
+	}
+	c.cache.Invalidate(key)
+	c.log.WithFields(map[string]interface{}{
+		"user":    username,
+		"src_mac": mac,
+	}).Debug("User evicted from cache")
+	c.notify(EvictedAction, username, userMac(mac))
+	return true
+}
+
+// EvictUsername removes every cache entry of a user
+func (c *Cache) EvictUsername(username string) int {
+	var evicted int
+	if c.cache == nil {
+		return evicted
+	}
+	for _, key := range c.cache.Keys() {
+		entry, found := c.cache.Peek(key)
+		if !found {
+			continue
+		}
+		if user, ok := entry.(User); ok && strings.EqualFold(user.Username, username) {
+			c.cache.Invalidate(key)
+			evicted++
+		}
+	}
+	if c.negative != nil {
+		for _, key := range c.negative.Keys() {
+			entry, found := c.negative.Peek(key)
+			if !found {
+				continue
+			}
+			if negative, ok := entry.(Negative); ok && strings.EqualFold(negative.Username, username) {
+				c.negative.Invalidate(key)
+			}
+		}
+	}
+	c.log.WithField("user", username).Debugf("%d entries evicted from cache", evicted)
+	if evicted > 0 {
+		c.notify(EvictedAction, username, "")
+	}
+	return evicted
+}
+
+// Flush removes every user, device, admin and client from the cache
+func (c *Cache) Flush() int {
+	if c.cache == nil {
+		return 0
+	}
+	flushed := c.cache.Len() + c.devices.Len() + c.admins.Len() + c.clients.Len()
+	c.cache.Purge()
+	c.devices.Purge()
+	c.admins.Purge()
+	c.clients.Purge()
+	if c.negative != nil {
+		flushed += c.negative.Len()
+		c.negative.Purge()
+	}
+	c.log.Debugf("Cache flushed, %d entries removed", flushed)
+	c.notify(FlushedAction, "", "")
+	return flushed
+}
+
+// GetNegative returns the last reject of a user/MAC pair by the authenticator, if still valid
+func (c *Cache) GetNegative(username string, mac string) (Negative, bool) {
+	return c.getNegative(getUserKey(username, mac))
+}
+
+// GetDeviceNegative returns the last reject of a PSK device by the authenticator, if still valid
+func (c *Cache) GetDeviceNegative(mac string) (Negative, bool) {
+	key, err := getDeviceKey(mac, false)
+	if err != nil {
+		return Negative{}, false
+	}
+	return c.getNegative(key)
+}
+
+// GetMabNegative returns the last reject of a MAC authentication bypass device by the authenticator, if still valid
+func (c *Cache) GetMabNegative(mac string) (Negative, bool) {
+	key, err := getDeviceKey(mac, true)
+	if err != nil {
+		return Negative{}, false
+	}
+	return c.getNegative(key)
+}
+
+func (c *Cache) getNegative(key string) (Negative, bool) {
+	if c.negative == nil {
+		return Negative{}, false
+	}
+	entry, found := c.negative.Get(key)
+	if !found {
+		return Negative{}, false
+	}
+	negative, ok := entry.(Negative)
+	return negative, ok
+}
+
+// AddNegative records a reject of a user/MAC pair by the authenticator
+func (c *Cache) AddNegative(username string, mac string, reason string) {
+	c.addNegative(getUserKey(username, mac), username, mac, reason)
+}
+
+// AddDeviceNegative records a reject of a PSK device by the authenticator
+func (c *Cache) AddDeviceNegative(mac string, reason string) {
+	if key, err := getDeviceKey(mac, false); err == nil {
+		c.addNegative(key, "", mac, reason)
+	}
+}
+
+// AddMabNegative records a reject of a MAC authentication bypass device by the authenticator
+func (c *Cache) AddMabNegative(mac string, reason string) {
+	if key, err := getDeviceKey(mac, true); err == nil {
+		c.addNegative(key, "", mac, reason)
+	}
+}
+
+func (c *Cache) addNegative(key string, username string, mac string, reason string) {
+	if c.negative == nil {
+		return
+	}
+	c.negative.Set(key, Negative{
+		Username: username,
+		Mac:      mac,
+		Reason:   reason,
+		Created:  time.Now(),
+	})
+	c.notify(NegativeAction, username, userMac(mac))
+}
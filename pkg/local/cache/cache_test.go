@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNegative(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(c *Cache)
+		// Only the entry added is rejected
+		wantUser, wantDevice, wantMab bool
+	}{
+		{
+			name:     "user",
+			add:      func(c *Cache) { c.AddNegative("alice", "aa:bb:cc:dd:ee:ff", "rejected") },
+			wantUser: true,
+		},
+		{
+			name:       "PSK device",
+			add:        func(c *Cache) { c.AddDeviceNegative("aa:bb:cc:dd:ee:ff", "not found") },
+			wantDevice: true,
+		},
+		{
+			name:    "MAB device",
+			add:     func(c *Cache) { c.AddMabNegative("aa:bb:cc:dd:ee:ff", "not found") },
+			wantMab: true,
+		},
+		{
+			name: "user accepted after a reject",
+			add: func(c *Cache) {
+				c.AddNegative("alice", "aa:bb:cc:dd:ee:ff", "rejected")
+				_ = c.AddUser(User{Username: "alice", Mac: "aa:bb:cc:dd:ee:ff", Password: "{clear}password"})
+			},
+		},
+		{
+			name: "PSK device accepted after a reject",
+			add: func(c *Cache) {
+				c.AddDeviceNegative("aa:bb:cc:dd:ee:ff", "not found")
+				_ = c.AddDevice(Device{Mac: "aa:bb:cc:dd:ee:ff", Psk: "psk"})
+			},
+		},
+		{
+			name: "PSK device evicted after a reject",
+			add: func(c *Cache) {
+				c.AddDeviceNegative("aa:bb:cc:dd:ee:ff", "not found")
+				c.EvictDevice("aa:bb:cc:dd:ee:ff")
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestCache(t, Configuration{NegativeTTL: time.Minute})
+			test.add(c)
+			// Every MAC format gives the same entry
+			if _, found := c.GetNegative("Alice", "AA-BB-CC-DD-EE-FF"); found != test.wantUser {
+				t.Fatalf("got user reject %v, want %v", found, test.wantUser)
+			}
+			if _, found := c.GetDeviceNegative("aabb.ccdd.eeff"); found != test.wantDevice {
+				t.Fatalf("got device reject %v, want %v", found, test.wantDevice)
+			}
+			if _, found := c.GetMabNegative("AABBCCDDEEFF"); found != test.wantMab {
+				t.Fatalf("got MAB reject %v, want %v", found, test.wantMab)
+			}
+		})
+	}
+}
+
+func TestNegativeDisabled(t *testing.T) {
+	c := newTestCache(t, Configuration{})
+	c.AddNegative("alice", "", "rejected")
+	c.AddDeviceNegative("aa:bb:cc:dd:ee:ff", "not found")
+	if _, found := c.GetNegative("alice", ""); found {
+		t.Fatal("user reject cached without negative TTL")
+	}
+	if _, found := c.GetDeviceNegative("aa:bb:cc:dd:ee:ff"); found {
+		t.Fatal("device reject cached without negative TTL")
+	}
+}
+
+func TestOfflineTTL(t *testing.T) {
+	c := newTestCache(t, Configuration{TTL: time.Hour, OfflineTTL: 24 * time.Hour})
+	if err := c.AddUser(User{Username: "alice", Password: "{clear}password", Created: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := c.GetUser("alice", ""); found {
+		t.Fatal("expired user found online")
+	}
+	done := make(chan struct{})
+	go func() {
+		// Status is read while the state changes
+		for i := 0; i < 100; i++ {
+			_ = c.Status()
+		}
+		close(done)
+	}()
+	c.SetOffline()
+	<-done
+	if !c.Status().Offline {
+		t.Fatal("cache not reported offline")
+	}
+	if _, found := c.GetUser("alice", ""); !found {
+		t.Fatal("user not kept while offline")
+	}
+	c.SetOnline()
+	if _, found := c.GetUser("alice", ""); found {
+		t.Fatal("expired user found back online")
+	}
+}
+
+func TestMalformedMac(t *testing.T) {
+	c := newTestCache(t, Configuration{NegativeTTL: time.Minute})
+	if err := c.AddDevice(Device{Mac: "not-a-mac", Psk: "psk"}); !errors.Is(err, MalformedMacError) {
+		t.Fatalf("got error %v, want %v", err, MalformedMacError)
+	}
+	if _, _, found := c.GetDeviceWithRefreshNeed("not-a-mac"); found {
+		t.Fatal("device with malformed MAC found")
+	}
+	c.AddDeviceNegative("not-a-mac", "not found")
+	if _, found := c.GetDeviceNegative("not-a-mac"); found {
+		t.Fatal("device with malformed MAC rejected from cache")
+	}
+	// Users with a malformed MAC share the entry without MAC
+	if err := c.AddUser(User{Username: "alice", Mac: "not-a-mac", Password: "{clear}password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := c.GetUser("alice", ""); !found {
+		t.Fatal("user with malformed MAC not found without MAC")
+	}
+	if _, found := c.GetUser("alice", "other-mac"); !found {
+		t.Fatal("user with malformed MAC not found with another malformed MAC")
+	}
+	if _, found := c.GetUser("alice", "aa:bb:cc:dd:ee:ff"); found {
+		t.Fatal("user with malformed MAC found with a valid MAC")
+	}
+}
+
+func TestMabDevice(t *testing.T) {
+	c := newTestCache(t, Configuration{NegativeTTL: time.Minute})
+	if err := c.AddDevice(Device{Mac: "aa:bb:cc:dd:ee:ff", Psk: "psk", VlanId: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddDevice(Device{Mac: "AA-BB-CC-DD-EE-FF", Mab: true, Fallback: true, VlanId: 99}); err != nil {
+		t.Fatal(err)
+	}
+	// The PSK and MAB entries of a MAC are apart
+	if device, _, found := c.GetDeviceWithRefreshNeed("aabb.ccdd.eeff"); !found || device.VlanId != 10 || device.Psk != "psk" {
+		t.Fatalf("got PSK device %v with VLAN %d, want VLAN 10", found, device.VlanId)
+	}
+	device, _, found := c.GetMabDeviceWithRefreshNeed("aabbccddeeff")
+	if !found || device.VlanId != 99 || !device.Fallback {
+		t.Fatalf("got MAB device %v with VLAN %d and fallback %v, want VLAN 99 in fallback", found, device.VlanId, device.Fallback)
+	}
+	if !c.EvictDevice("aa:bb:cc:dd:ee:ff") {
+		t.Fatal("PSK device not evicted")
+	}
+	if _, _, found := c.GetMabDeviceWithRefreshNeed("aa:bb:cc:dd:ee:ff"); !found {
+		t.Fatal("MAB device evicted with the PSK one")
+	}
+	c.AddMabNegative("aa:bb:cc:dd:ee:ff", "not found")
+	if !c.EvictMabDevice("aa:bb:cc:dd:ee:ff") {
+		t.Fatal("MAB device not evicted")
+	}
+	if _, found := c.GetMabNegative("aa:bb:cc:dd:ee:ff"); found {
+		t.Fatal("MAB reject kept after eviction")
+	}
+}
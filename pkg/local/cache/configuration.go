@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"fmt"
+	"github.com/COSAE-FR/riputils/common"
 	"github.com/creasty/defaults"
 	"time"
 )
@@ -10,11 +12,41 @@ type Configuration struct {
 	TTL        time.Duration `yaml:"ttl" default:"12h"`
 	RefreshTTL time.Duration `yaml:"refresh_ttl" default:"1h"`
 	OfflineTTL time.Duration `yaml:"offline_ttl"`
+	// Snapshot file, loaded at start and written at intervals and on shutdown
+	Path         string        `yaml:"path"`
+	SaveInterval time.Duration `yaml:"save_interval" default:"5m"`
+	// Cached secrets are encrypted with a key derived from this file content, or from the RADIUS secret
+	KeyFile string `yaml:"key_file"`
+	Secret  string `yaml:"-"`
+	// Store cleartext passwords as NT hashes
+	NTHash bool `yaml:"nt_hash"`
+	// Devices authorized by MAC address with a PSK, with the user TTLs
+	DeviceMaxSize int `yaml:"device_size" default:"1000"`
+	// Upstream rejects, disabled without TTL
+	NegativeMaxSize int           `yaml:"negative_size" default:"1000"`
+	NegativeTTL     time.Duration `yaml:"negative_ttl"`
+	// Dynamic RADIUS clients
+	ClientMaxSize    int           `yaml:"client_size" default:"256"`
+	ClientTTL        time.Duration `yaml:"client_ttl" default:"24h"`
+	ClientRefreshTTL time.Duration `yaml:"client_refresh_ttl" default:"1h"`
+	// Management logins
+	AdminMaxSize    int           `yaml:"admin_size" default:"100"`
+	AdminTTL        time.Duration `yaml:"admin_ttl" default:"1h"`
+	AdminRefreshTTL time.Duration `yaml:"admin_refresh_ttl" default:"5m"`
+	AdminOfflineTTL time.Duration `yaml:"admin_offline_ttl" default:"24h"`
+	// Accept cached management logins when the authenticator is offline
+	AdminOffline bool `yaml:"admin_offline"`
 }
 
 func (c *Configuration) Check() error {
 	if err := defaults.Set(c); err != nil {
 		return err
 	}
+	if len(c.KeyFile) > 0 && !common.FileExists(c.KeyFile) {
+		return fmt.Errorf("cache key file %s does not exist", c.KeyFile)
+	}
+	if len(c.Path) > 0 && c.SaveInterval <= 0 {
+		return fmt.Errorf("cache save interval must be positive")
+	}
 	return nil
 }
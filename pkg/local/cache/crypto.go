@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/md4"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const encryptedPrefix = "enc:"
+
+// cleartextHeaders are the Password-With-Header prefixes holding a cleartext password
+var cleartextHeaders = []string{"{clear}", "{cleartext}", "{cleartext-password}"}
+
+func newCipher(config *Configuration) (cipher.AEAD, bool, error) {
+	var secret []byte
+	persistent := true
+	switch {
+	case len(config.KeyFile) > 0:
+		content, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot read cache key file: %w", err)
+		}
+		secret = []byte(strings.TrimSpace(string(content)))
+	case len(config.Secret) > 0:
+		secret = []byte(config.Secret)
+	default:
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, false, err
+		}
+		persistent = false
+	}
+	if len(secret) == 0 {
+		return nil, false, errors.New("empty cache key")
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("ripradius cache")), key); err != nil {
+		return nil, false, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, false, err
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, persistent, err
+}
+
+func (c *Cache) seal(value string) (string, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cache) open(value string) (string, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return "", errors.New("cached value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("cached value is too short")
+	}
+	nonce, data := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// cleartextPassword extracts the password from a Password-With-Header value, if stored in cleartext
+func cleartextPassword(password string) (string, bool) {
+	if !strings.HasPrefix(password, "{") {
+		return password, true
+	}
+	lower := strings.ToLower(password)
+	for _, header := range cleartextHeaders {
+		if strings.HasPrefix(lower, header) {
+			return password[len(header):], true
+		}
+	}
+	return "", false
+}
+
+// ntHash converts a cleartext Password-With-Header to an NT-Password one, usable by PAP and MS-CHAP
+func ntHash(password string) string {
+	plain, ok := cleartextPassword(password)
+	if !ok || len(plain) == 0 {
+		return password
+	}
+	encoded := utf16.Encode([]rune(plain))
+	buffer := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(buffer[2*i:], r)
+	}
+	hash := md4.New()
+	hash.Write(buffer)
+	return "{NT}" + hex.EncodeToString(hash.Sum(nil))
+}
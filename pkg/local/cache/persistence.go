@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type snapshot struct {
+	Saved   time.Time `json:"saved"`
+	Users   []User    `json:"users"`
+	Clients []Client  `json:"clients"`
+	Admins  []Admin   `json:"admins"`
+	Devices []Device  `json:"devices"`
+}
+
+// restorable reports if an entry of this age can still be used, online or offline
+func restorable(age time.Duration, ttl time.Duration, offlineTTL time.Duration) bool {
+	if offlineTTL == 0 {
+		return true
+	}
+	if offlineTTL > ttl {
+		ttl = offlineTTL
+	}
+	return age < ttl
+}
+
+func (c *Cache) save() error {
+	data := snapshot{Saved: time.Now()}
+	for _, key := range c.cache.Keys() {
+		if entry, found := c.cache.Peek(key); found {
+			if user, ok := entry.(User); ok {
+				data.Users = append(data.Users, user)
+			}
+		}
+	}
+	for _, key := range c.clients.Keys() {
+		if entry, found := c.clients.Peek(key); found {
+			if client, ok := entry.(Client); ok {
+				data.Clients = append(data.Clients, client)
+			}
+		}
+	}
+	for _, key := range c.admins.Keys() {
+		if entry, found := c.admins.Peek(key); found {
+			if admin, ok := entry.(Admin); ok {
+				data.Admins = append(data.Admins, admin)
+			}
+		}
+	}
+	for _, key := range c.devices.Keys() {
+		if entry, found := c.devices.Peek(key); found {
+			if device, ok := entry.(Device); ok {
+				data.Devices = append(data.Devices, device)
+			}
+		}
+	}
+	content, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.config.Path), 0700); err != nil {
+		return err
+	}
+	tmp := c.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.config.Path); err != nil {
+		return err
+	}
+	c.log.Tracef("Cache snapshot written with %d users, %d devices, %d clients and %d admins", len(data.Users), len(data.Devices), len(data.Clients), len(data.Admins))
+	return nil
+}
+
+func (c *Cache) load() error {
+	content, err := os.ReadFile(c.config.Path)
+	if os.IsNotExist(err) {
+		c.log.Debugf("No cache snapshot at %s", c.config.Path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	data := snapshot{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	// Oldest first, so the LRU order is kept
+	sort.Slice(data.Users, func(i, j int) bool { return data.Users[i].Created.Before(data.Users[j].Created) })
+	sort.Slice(data.Clients, func(i, j int) bool { return data.Clients[i].Created.Before(data.Clients[j].Created) })
+	sort.Slice(data.Admins, func(i, j int) bool { return data.Admins[i].Created.Before(data.Admins[j].Created) })
+	sort.Slice(data.Devices, func(i, j int) bool { return data.Devices[i].Created.Before(data.Devices[j].Created) })
+	var users, devices, clients, admins, unreadable int
+	for _, user := range data.Users {
+		if user.Created.IsZero() || !restorable(time.Since(user.Created), c.config.TTL, c.config.OfflineTTL) {
+			continue
+		}
+		if _, err := c.open(user.Password); err != nil {
+			unreadable++
+			continue
+		}
+		c.cache.Set(getUserKey(user.Username, user.Mac), user)
+		users++
+	}
+	for _, device := range data.Devices {
+		if device.Created.IsZero() || !restorable(time.Since(device.Created), c.config.TTL, c.config.OfflineTTL) {
+			continue
+		}
+		if _, err := c.open(device.Psk); err != nil {
+			unreadable++
+			continue
+		}
+		key, err := getDeviceKey(device.Mac, device.Mab)
+		if err != nil {
+			continue
+		}
+		c.devices.Set(key, device)
+		devices++
+	}
+	for _, client := range data.Clients {
+		if client.Created.IsZero() || !restorable(time.Since(client.Created), c.config.ClientTTL, c.config.OfflineTTL) {
+			continue
+		}
+		if _, err := c.open(client.Secret); err != nil {
+			unreadable++
+			continue
+		}
+		c.clients.Set(getClientKey(client.IP), client)
+		clients++
+	}
+	for _, admin := range data.Admins {
+		if admin.Created.IsZero() || !restorable(time.Since(admin.Created), c.config.AdminTTL, c.config.AdminOfflineTTL) {
+			continue
+		}
+		if _, err := c.open(admin.Password); err != nil {
+			unreadable++
+			continue
+		}
+		c.admins.Set(getAdminKey(admin.Username, admin.Nas), admin)
+		admins++
+	}
+	if unreadable > 0 {
+		c.log.Warnf("%d cache snapshot entries cannot be decrypted with the current key, ignoring them", unreadable)
+	}
+	c.log.Debugf("Cache snapshot from %s loaded with %d users, %d devices, %d clients and %d admins", data.Saved.Format(time.RFC3339), users, devices, clients, admins)
+	return nil
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, config Configuration) *Cache {
+	t.Helper()
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(log.NewEntry(log.New()), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	config := Configuration{
+		Path:   filepath.Join(t.TempDir(), "cache", "snapshot.json"),
+		Secret: "radius secret",
+	}
+	saved := newTestCache(t, config)
+	if err := saved.AddUser(User{Username: "alice", Password: "{clear}password", Mac: "AA-BB-CC-DD-EE-FF", VlanId: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.AddDevice(Device{Mac: "00:11:22:33:44:55", Psk: "device psk", VlanId: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.AddDevice(Device{Mac: "00:11:22:33:44:55", Mab: true, VlanId: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.AddClient(Client{IP: "192.0.2.1", Shortname: "ap1", Secret: "nas secret", Server: "rip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.AddAdmin(Admin{Username: "admin", Password: "{clear}admin", Nas: "192.0.2.1", Class: "operator"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(config.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("snapshot mode %o, want 600", info.Mode().Perm())
+	}
+
+	loaded := newTestCache(t, config)
+	user, found := loaded.GetUser("alice", "aa:bb:cc:dd:ee:ff")
+	if !found || user.Password != "{clear}password" || user.VlanId != 10 {
+		t.Fatalf("user not restored: %+v, %v", user, found)
+	}
+	device, _, found := loaded.GetDeviceWithRefreshNeed("00-11-22-33-44-55")
+	if !found || device.Psk != "device psk" || device.VlanId != 20 {
+		t.Fatalf("device not restored: %+v, %v", device, found)
+	}
+	device, _, found = loaded.GetMabDeviceWithRefreshNeed("00-11-22-33-44-55")
+	if !found || !device.Mab || device.VlanId != 30 {
+		t.Fatalf("MAB device not restored: %+v, %v", device, found)
+	}
+	client, _, found := loaded.GetClientWithRefreshNeed("192.0.2.1")
+	if !found || client.Secret != "nas secret" || client.Shortname != "ap1" {
+		t.Fatalf("client not restored: %+v, %v", client, found)
+	}
+	admin, _, found := loaded.GetAdminWithRefreshNeed("admin", "192.0.2.1")
+	if !found || admin.Password != "{clear}admin" || admin.Class != "operator" {
+		t.Fatalf("admin not restored: %+v, %v", admin, found)
+	}
+}
+
+func TestSnapshotSkipsEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		loadWith Configuration
+		created  time.Time
+	}{
+		{
+			name:     "expired online and offline",
+			loadWith: Configuration{TTL: time.Hour, OfflineTTL: 2 * time.Hour},
+			created:  time.Now().Add(-3 * time.Hour),
+		},
+		{
+			name:     "encrypted with another key",
+			loadWith: Configuration{Secret: "other secret"},
+			created:  time.Now(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			saved := newTestCache(t, Configuration{Path: path, Secret: "radius secret"})
+			if err := saved.AddUser(User{Username: "alice", Password: "{clear}password", Created: test.created}); err != nil {
+				t.Fatal(err)
+			}
+			if err := saved.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			config := test.loadWith
+			config.Path = path
+			if len(config.Secret) == 0 {
+				config.Secret = "radius secret"
+			}
+			if _, found := newTestCache(t, config).GetUser("alice", ""); found {
+				t.Fatal("user restored")
+			}
+		})
+	}
+}
+
+func TestSnapshotMissing(t *testing.T) {
+	c := newTestCache(t, Configuration{Path: filepath.Join(t.TempDir(), "missing.json"), Secret: "radius secret"})
+	if status := c.Status(); status.Entries != 0 {
+		t.Fatalf("got %d entries, want 0", status.Entries)
+	}
+}
+
+func TestConfigurationSaveInterval(t *testing.T) {
+	config := Configuration{Path: "/var/db/ripradius/cache.json", SaveInterval: -time.Minute}
+	if err := config.Check(); err == nil {
+		t.Fatal("expected an error for a negative save interval")
+	}
+	config = Configuration{Path: "/var/db/ripradius/cache.json"}
+	if err := config.Check(); err != nil || config.SaveInterval <= 0 {
+		t.Fatalf("got interval %s and error %v, want the default interval", config.SaveInterval, err)
+	}
+}
@@ -1,88 +1,177 @@
 package client
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	ubinding "github.com/COSAE-FR/ripradius/pkg/updater/binding"
-	"github.com/COSAE-FR/ripradius/pkg/utils"
-	"github.com/COSAE-FR/riputils/common"
 	"github.com/go-resty/resty/v2"
 	log "github.com/sirupsen/logrus"
-	"net"
-	"net/http"
-	"net/url"
+	"math/rand"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
 var UserRejectedError = errors.New("user rejected")
 var UserNotFoundError = errors.New("user not found")
+var ClientNotFoundError = errors.New("client not found")
 
 type Client struct {
-	client *resty.Client
-	config *Configuration
+	upstreams []*upstream
+	// round-robin counter
+	next uint32
+	// URL of the last server which answered
+	active atomic.Value
+	// TLS material and token, replaced on reload
+	credentials atomic.Pointer[credentials]
+	config      *Configuration
+	done        chan struct{}
 }
 
 func New(config Configuration) (*Client, error) {
-	client := resty.New()
-	client.SetBaseURL(config.Server)
-	client.SetHeaders(map[string]string{
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
-		"User-Agent":   fmt.Sprintf("%s/%s", utils.Name, utils.Version),
-	})
-	u, err := url.Parse(config.Server)
+	c := &Client{config: &config}
+	creds, err := newCredentials(&config)
 	if err != nil {
 		return nil, err
 	}
-	if u.Scheme == "https" {
-		if len(config.Certificate) > 0 && len(config.Key) > 0 {
-			cert, err := tls.X509KeyPair([]byte(config.Certificate), []byte(config.Key))
-			if err != nil {
-				return nil, err
-			}
-			client.SetCertificates(cert)
-		}
-		if len(config.CA) > 0 {
-			client.SetRootCertificate(config.CA)
+	c.credentials.Store(creds)
+	for _, server := range config.Servers {
+		u, err := newUpstream(&config, server, &c.credentials)
+		if err != nil {
+			return nil, fmt.Errorf("cannot configure authenticator %s: %w", server, err)
 		}
+		c.upstreams = append(c.upstreams, u)
+	}
+	c.active.Store("")
+	return c, nil
+}
+
+// candidates returns the servers to try, in order, according to the strategy.
+// Servers marked down are kept at the end, as a last resort.
+func (c *Client) candidates() []*upstream {
+	ordered := make([]*upstream, 0, len(c.upstreams))
+	if c.config.Strategy == RoundRobinStrategy && len(c.upstreams) > 0 {
+		start := int(atomic.AddUint32(&c.next, 1)-1) % len(c.upstreams)
+		ordered = append(ordered, c.upstreams[start:]...)
+		ordered = append(ordered, c.upstreams[:start]...)
+	} else {
+		ordered = append(ordered, c.upstreams...)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].available(c.config.RetryDelay) && !ordered[j].available(c.config.RetryDelay)
+	})
+	return ordered
+}
+
+// backoff returns a jittered wait before retry attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.config.retryWait(attempt)
+	half := int64(wait / 2)
+	if half <= 0 {
+		return wait
 	}
-	transport := &http.Transport{}
-	if len(config.SourceInterface) > 0 {
-		ip, err := common.GetIPForInterface(config.SourceInterface)
-		if err == nil {
-			dialer := &net.Dialer{
-				Timeout:   10 * time.Second,
-				LocalAddr: &net.TCPAddr{IP: ip.IP.To4()},
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// send sends a request to a server with the configured timeout
+func (c *Client) send(ctx context.Context, u *upstream, request func(r *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	callCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	return request(u.client.R().SetContext(callCtx))
+}
+
+// do sends a request to the authenticator servers until one answers without a server error.
+// Transport errors are retried with backoff, answers are never retried.
+func (c *Client) do(ctx context.Context, request func(r *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	var lastErr = errors.New("no authenticator server configured")
+	for attempt := 0; attempt <= c.config.Retries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff(attempt)
+			log.Debugf("Retrying authenticators in %s: %s", wait, lastErr)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		var transportError bool
+		for _, u := range c.candidates() {
+			resp, err := c.send(ctx, u, request)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, err
+				}
+				transportError = true
+			} else if resp.StatusCode() >= 500 {
+				err = fmt.Errorf("server error: %d: %s", resp.StatusCode(), resp.Status())
 			}
-			if u.Scheme == "https" {
-				transport.DialTLSContext = dialer.DialContext
-			} else {
-				transport.DialContext = dialer.DialContext
+			if err != nil {
+				log.Debugf("Authenticator %s failed: %s", u.url, err)
+				u.failure(err)
+				lastErr = err
+				continue
 			}
-		} else {
-			log.Errorf("Cannot get interface %s IP: %s", config.SourceInterface, err)
+			u.success()
+			c.active.Store(u.url)
+			return resp, nil
+		}
+		if !transportError {
+			break
 		}
 	}
-	client.SetTransport(transport)
-	if len(config.Token) > 0 {
-		client.SetAuthToken(config.Token)
+	return nil, lastErr
+}
+
+// MaxCallDuration returns the longest time a call can take, with every server timing out on every retry
+func (c *Client) MaxCallDuration() time.Duration {
+	return c.config.MaxCallDuration()
+}
+
+// Status returns the health of the authenticator servers
+func (c *Client) Status() binding.UpstreamStatus {
+	status := binding.UpstreamStatus{
+		Strategy: c.config.Strategy,
+		Active:   c.active.Load().(string),
+	}
+	for _, u := range c.upstreams {
+		status.Servers = append(status.Servers, u.status(c.config.RetryDelay))
 	}
-	return &Client{
-		client: client,
-		config: &config,
-	}, nil
+	return status
+}
+
+// upstreamRequest returns a copy of the request with the MAC addresses in the configured format
+func (c *Client) upstreamRequest(request *binding.UserRequest) *binding.UserRequest {
+	upstreamRequest := *request
+	if mac, err := radius.ParseMAC(request.ClientMac); err == nil {
+		upstreamRequest.ClientMac = radius.FormatMAC(mac, c.config.MacFormat, c.config.MacUppercase)
+	}
+	if mac, err := radius.ParseMAC(request.Username); err == nil && mac.String() == request.GetClientMac() {
+		upstreamRequest.Username = radius.FormatMAC(mac, c.config.MacFormat, c.config.MacUppercase)
+	}
+	return &upstreamRequest
 }
 
 func (c *Client) getUrl(path string) string {
 	return fmt.Sprintf("api/v%d/%s", c.config.ApiVersion, path)
 }
 
-/*
-func (c *Client) GetStatus() (*StatusResponse, error) {
-	resp, err := c.client.R().Get(c.getUrl("status"))
+// StatusResponse is the authenticator status
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+func (c *Client) GetStatus(ctx context.Context) (*StatusResponse, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.Get(c.getUrl("status"))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -95,16 +184,21 @@ func (c *Client) GetStatus() (*StatusResponse, error) {
 		return status, nil
 	}
 	return nil, fmt.Errorf("cannot get server status: %d: %s", statusCode, resp.Status())
-} */
+}
 
-func (c *Client) GetUser(userRequest *binding.UserRequest) (*binding.RadiusUserResponse, error) {
-	resp, err := c.client.R().SetBody(userRequest).Post(c.getUrl("authorize"))
+func (c *Client) GetUser(ctx context.Context, userRequest *binding.UserRequest) (*binding.RadiusUserResponse, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetBody(c.upstreamRequest(userRequest)).Post(c.getUrl("authorize"))
+	})
 	if err != nil {
 		return nil, err
 	}
 	statusCode := resp.StatusCode()
 	switch statusCode {
 	case 200:
+		if c.config.ApiVersion >= 2 {
+			return c.decodeUser(resp.Body())
+		}
 		user := &binding.RadiusUserResponse{}
 		if err := json.Unmarshal(resp.Body(), user); err != nil {
 			return nil, err
@@ -119,8 +213,172 @@ func (c *Client) GetUser(userRequest *binding.UserRequest) (*binding.RadiusUserR
 	}
 }
 
-func (c *Client) GetCertificate() (*ubinding.RadiusCertificate, error) {
-	resp, err := c.client.R().Get(c.getUrl("certificate"))
+// decodeUser converts an API version 2 answer, dropping the reply attributes not allowed
+func (c *Client) decodeUser(body []byte) (*binding.RadiusUserResponse, error) {
+	upstreamUser := &binding.UpstreamUserResponse{}
+	if err := json.Unmarshal(body, upstreamUser); err != nil {
+		return nil, err
+	}
+	if len(upstreamUser.Password) == 0 {
+		return nil, errors.New("no password in user authorization")
+	}
+	attributes, errs := upstreamUser.Attributes.Filter(c.config.AllowedAttributes)
+	for _, err := range errs {
+		log.Warnf("Ignoring reply attribute from authenticator: %s", err)
+	}
+	return &binding.RadiusUserResponse{
+		Password:   upstreamUser.Password,
+		VLAN:       upstreamUser.VLAN,
+		Role:       upstreamUser.Role,
+		Attributes: attributes,
+	}, nil
+}
+
+// GetDevice returns the PSK and VLAN of a device authorized by its MAC address
+func (c *Client) GetDevice(ctx context.Context, deviceRequest *binding.UserRequest) (*binding.UpstreamDeviceResponse, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetBody(c.upstreamRequest(deviceRequest)).Post(c.getUrl("device"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	statusCode := resp.StatusCode()
+	switch statusCode {
+	case 200:
+		device := &binding.UpstreamDeviceResponse{}
+		if err := json.Unmarshal(resp.Body(), device); err != nil {
+			return nil, err
+		}
+		if len(device.Psk) < 8 || len(device.Psk) > 63 {
+			return nil, fmt.Errorf("invalid PSK for device %s: length must be between 8 and 63", deviceRequest.GetClientMac())
+		}
+		attributes, errs := device.Attributes.Filter(c.config.AllowedAttributes)
+		for _, err := range errs {
+			log.Warnf("Ignoring reply attribute from authenticator: %s", err)
+		}
+		device.Attributes = attributes
+		return device, nil
+	case 401:
+		return nil, UserRejectedError
+	case 404:
+		return nil, UserNotFoundError
+	default:
+		return nil, fmt.Errorf("cannot get device authorization: %d: %s", statusCode, resp.Status())
+	}
+}
+
+// GetMab returns the VLAN of a device authorized by MAC authentication bypass
+func (c *Client) GetMab(ctx context.Context, deviceRequest *binding.UserRequest) (*binding.UpstreamUserResponse, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetBody(c.upstreamRequest(deviceRequest)).Post(c.getUrl("mab"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	statusCode := resp.StatusCode()
+	switch statusCode {
+	case 200:
+		device := &binding.UpstreamUserResponse{}
+		if err := json.Unmarshal(resp.Body(), device); err != nil {
+			return nil, err
+		}
+		attributes, errs := device.Attributes.Filter(c.config.AllowedAttributes)
+		for _, err := range errs {
+			log.Warnf("Ignoring reply attribute from authenticator: %s", err)
+		}
+		device.Attributes = attributes
+		return device, nil
+	case 401:
+		return nil, UserRejectedError
+	case 404:
+		return nil, UserNotFoundError
+	default:
+		return nil, fmt.Errorf("cannot get MAB authorization: %d: %s", statusCode, resp.Status())
+	}
+}
+
+// PostAccounting sends accounting records to the authenticator
+func (c *Client) PostAccounting(ctx context.Context, records []session.Record) error {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetBody(records).Post(c.getUrl("accounting"))
+	})
+	if err != nil {
+		return err
+	}
+	statusCode := resp.StatusCode()
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("cannot send accounting records: %d: %s", statusCode, resp.Status())
+}
+
+func (c *Client) GetAdmin(ctx context.Context, userRequest *binding.UserRequest) (*binding.UpstreamAdminResponse, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetBody(c.upstreamRequest(userRequest)).Post(c.getUrl("admin"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	statusCode := resp.StatusCode()
+	switch statusCode {
+	case 200:
+		admin := &binding.UpstreamAdminResponse{}
+		if err := json.Unmarshal(resp.Body(), admin); err != nil {
+			return nil, err
+		}
+		if len(admin.Password) == 0 {
+			return nil, errors.New("no password in admin authorization")
+		}
+		attributes, errs := admin.Attributes.Filter(c.config.AllowedAttributes)
+		for _, err := range errs {
+			log.Warnf("Ignoring reply attribute from authenticator: %s", err)
+		}
+		admin.Attributes = attributes
+		return admin, nil
+	case 401:
+		return nil, UserRejectedError
+	case 404:
+		return nil, UserNotFoundError
+	default:
+		return nil, fmt.Errorf("cannot get admin authorization: %d: %s", statusCode, resp.Status())
+	}
+}
+
+func (c *Client) GetDynamicClient(ctx context.Context, ip string) (*binding.DynamicClient, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.SetQueryParam("ip", ip).Get(c.getUrl("dynamic-client"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	statusCode := resp.StatusCode()
+	switch statusCode {
+	case 200:
+		client := &binding.DynamicClient{}
+		if err := json.Unmarshal(resp.Body(), client); err != nil {
+			return nil, err
+		}
+		if len(client.Secret) == 0 {
+			return nil, fmt.Errorf("no secret for dynamic client %s", ip)
+		}
+		if len(client.Shortname) == 0 {
+			client.Shortname = ip
+		}
+		if len(client.Server) == 0 {
+			client.Server = binding.AdminVirtualServer
+		}
+		return client, nil
+	case 404:
+		return nil, ClientNotFoundError
+	default:
+		return nil, fmt.Errorf("cannot get dynamic client: %d: %s", statusCode, resp.Status())
+	}
+}
+
+func (c *Client) GetCertificate(ctx context.Context) (*ubinding.RadiusCertificate, error) {
+	resp, err := c.do(ctx, func(r *resty.Request) (*resty.Response, error) {
+		return r.Get(c.getUrl("certificate"))
+	})
 	if err != nil {
 		return nil, err
 	}
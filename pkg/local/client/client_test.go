@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer is an authenticator counting its requests
+type fakeServer struct {
+	*httptest.Server
+	calls atomic.Int32
+}
+
+func newFakeServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, call int)) *fakeServer {
+	t.Helper()
+	server := &fakeServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, int(server.calls.Add(1)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func status(code int) func(w http.ResponseWriter, r *http.Request, call int) {
+	return func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"status":"ok","version":"1"}`))
+	}
+}
+
+// dropFirst closes the connection of the first request, then answers with code
+func dropFirst(code int) func(w http.ResponseWriter, r *http.Request, call int) {
+	return func(w http.ResponseWriter, r *http.Request, call int) {
+		if call == 1 {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+		status(code)(w, r, call)
+	}
+}
+
+func newTestClient(t *testing.T, config Configuration, servers ...*fakeServer) *Client {
+	t.Helper()
+	for _, server := range servers {
+		config.Servers = append(config.Servers, server.URL)
+	}
+	config.Token = "token"
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestFailover(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      func(w http.ResponseWriter, r *http.Request, call int)
+		second     func(w http.ResponseWriter, r *http.Request, call int)
+		retries    int
+		wantErr    bool
+		wantFirst  int32
+		wantSecond int32
+		wantActive int
+	}{
+		{
+			name:       "first server answers",
+			first:      status(http.StatusOK),
+			second:     status(http.StatusOK),
+			wantFirst:  1,
+			wantActive: 1,
+		},
+		{
+			name:       "server error fails over",
+			first:      status(http.StatusServiceUnavailable),
+			second:     status(http.StatusOK),
+			wantFirst:  1,
+			wantSecond: 1,
+			wantActive: 2,
+		},
+		{
+			name:       "client error is an answer",
+			first:      status(http.StatusNotFound),
+			second:     status(http.StatusOK),
+			wantErr:    true,
+			wantFirst:  1,
+			wantActive: 1,
+		},
+		{
+			name:       "every server failing",
+			first:      status(http.StatusInternalServerError),
+			second:     status(http.StatusBadGateway),
+			retries:    2,
+			wantErr:    true,
+			wantFirst:  1,
+			wantSecond: 1,
+		},
+		{
+			name:       "transport errors are retried",
+			first:      dropFirst(http.StatusOK),
+			second:     dropFirst(http.StatusOK),
+			retries:    1,
+			wantFirst:  2,
+			wantSecond: 1,
+			wantActive: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first, second := newFakeServer(t, test.first), newFakeServer(t, test.second)
+			client := newTestClient(t, Configuration{Retries: test.retries, RetryWait: time.Millisecond}, first, second)
+			// Check replaces no retry with the default
+			client.config.Retries = test.retries
+			_, err := client.GetStatus(context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if calls := first.calls.Load(); calls != test.wantFirst {
+				t.Fatalf("first server called %d times, want %d", calls, test.wantFirst)
+			}
+			if calls := second.calls.Load(); calls != test.wantSecond {
+				t.Fatalf("second server called %d times, want %d", calls, test.wantSecond)
+			}
+			active := client.Status().Active
+			switch test.wantActive {
+			case 1:
+				if active != first.URL {
+					t.Fatalf("active server %s, want the first one", active)
+				}
+			case 2:
+				if active != second.URL {
+					t.Fatalf("active server %s, want the second one", active)
+				}
+			}
+		})
+	}
+}
+
+func TestFailedServerSkipped(t *testing.T) {
+	first, second := newFakeServer(t, status(http.StatusServiceUnavailable)), newFakeServer(t, status(http.StatusOK))
+	client := newTestClient(t, Configuration{RetryDelay: time.Minute}, first, second)
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetStatus(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The failed server is not tried again during the retry delay
+	if calls := first.calls.Load(); calls != 1 {
+		t.Fatalf("failed server called %d times, want 1", calls)
+	}
+	if calls := second.calls.Load(); calls != 3 {
+		t.Fatalf("second server called %d times, want 3", calls)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	first, second := newFakeServer(t, status(http.StatusOK)), newFakeServer(t, status(http.StatusOK))
+	client := newTestClient(t, Configuration{Strategy: RoundRobinStrategy}, first, second)
+	for i := 0; i < 4; i++ {
+		if _, err := client.GetStatus(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.calls.Load() != 2 || second.calls.Load() != 2 {
+		t.Fatalf("servers called %d and %d times, want 2 each", first.calls.Load(), second.calls.Load())
+	}
+}
+
+func TestCallCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := newFakeServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	client := newTestClient(t, Configuration{Timeout: time.Minute, RetryWait: time.Minute}, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err := client.GetStatus(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("call ended after %s, not with its context", elapsed)
+	}
+	if calls := server.calls.Load(); calls != 1 {
+		t.Fatalf("server called %d times, want 1", calls)
+	}
+}
+
+func TestGetUserAnswers(t *testing.T) {
+	tests := []struct {
+		code    int
+		wantErr error
+	}{
+		{code: http.StatusUnauthorized, wantErr: UserRejectedError},
+		{code: http.StatusNotFound, wantErr: UserNotFoundError},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.code), func(t *testing.T) {
+			server := newFakeServer(t, status(test.code))
+			client := newTestClient(t, Configuration{Retries: 2}, server)
+			if _, err := client.GetUser(context.Background(), &binding.UserRequest{Username: "alice"}); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if calls := server.calls.Load(); calls != 1 {
+				t.Fatalf("server called %d times, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestMaxCallDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Configuration
+		want   time.Duration
+	}{
+		{
+			name:   "one server without retry",
+			config: Configuration{Servers: []string{"a"}, Timeout: time.Second},
+			want:   time.Second,
+		},
+		{
+			name:   "two servers with retries",
+			config: Configuration{Servers: []string{"a", "b"}, Timeout: time.Second, Retries: 2, RetryWait: 100 * time.Millisecond, RetryMaxWait: time.Second},
+			want:   6*time.Second + 100*time.Millisecond + 200*time.Millisecond,
+		},
+		{
+			name:   "backoff capped",
+			config: Configuration{Servers: []string{"a"}, Timeout: time.Second, Retries: 3, RetryWait: time.Second, RetryMaxWait: 1500 * time.Millisecond},
+			want:   4*time.Second + time.Second + 1500*time.Millisecond + 1500*time.Millisecond,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.MaxCallDuration(); got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -2,64 +2,174 @@ package client
 
 import (
 	"fmt"
-	"github.com/COSAE-FR/riputils/common"
+	"github.com/COSAE-FR/ripradius/pkg/pki"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
 	"github.com/creasty/defaults"
-	"io/ioutil"
+	"github.com/go-playground/validator/v10"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 )
 
 type Configuration struct {
-	Server          string `yaml:"server"`
-	ApiVersion      uint16 `yaml:"api_version" default:"1"`
-	Token           string `yaml:"token"`
-	CA              string `yaml:"ca"`
-	Certificate     string `yaml:"certificate"`
-	Key             string `yaml:"key"`
-	SourceInterface string `yaml:"source_interface"`
+	// Server is kept for compatibility, it is tried before Servers
+	Server  string   `yaml:"server"`
+	Servers []string `yaml:"servers"`
+	// Strategy is failover (in order) or round-robin
+	Strategy string `yaml:"strategy" default:"failover" validate:"oneof=failover round-robin"`
+	// A failed server is not tried again before this delay, unless every other one failed too
+	RetryDelay time.Duration `yaml:"retry_delay" default:"30s"`
+	// Timeout of a single request to a server
+	Timeout time.Duration `yaml:"timeout" default:"3s"`
+	// Retries after transport errors on every server, with jittered exponential backoff
+	Retries      int           `yaml:"retries" default:"1"`
+	RetryWait    time.Duration `yaml:"retry_wait" default:"200ms"`
+	RetryMaxWait time.Duration `yaml:"retry_max_wait" default:"2s"`
+	// API version 2 answers carry reply attributes
+	ApiVersion uint16 `yaml:"api_version" default:"1" validate:"min=1,max=2"`
+	// Format of the MAC addresses sent to the authenticator: colon, hyphen, dot or bare
+	MacFormat    string `yaml:"mac_format" default:"colon" validate:"oneof=colon hyphen dot bare"`
+	MacUppercase bool   `yaml:"mac_uppercase"`
+	// Reply attributes accepted from the authenticator, with their type, in addition to the default ones
+	AllowedAttributes map[string]string `yaml:"allowed_attributes"`
+	// Auth is token (static bearer token) or hmac (signed requests)
+	Auth  string `yaml:"auth" default:"token" validate:"oneof=token hmac"`
+	Token string `yaml:"token"`
+	// Secret the hmac signing key is derived from, the Freeradius secret by default
+	SigningSecret string `yaml:"signing_secret"`
+	// File holding the token, used instead of Token
+	TokenFile   string `yaml:"token_file"`
+	CA          string `yaml:"ca"`
+	Certificate string `yaml:"certificate"`
+	Key         string `yaml:"key"`
+	// File holding the passphrase of an encrypted key
+	KeyPassphraseFile string `yaml:"key_passphrase_file"`
+	SourceInterface   string `yaml:"source_interface"`
+	// Files given for TokenFile, CA, Certificate and Key are checked for changes at this interval, 0 disables
+	ReloadInterval time.Duration `yaml:"reload_interval" default:"1m"`
+	// Files of the TLS material, empty when given as PEM
+	caFile          string
+	certificateFile string
+	keyFile         string
 }
 
 func (c *Configuration) Check() error {
 	if err := defaults.Set(c); err != nil {
 		return err
 	}
-	if len(c.Server) == 0 {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	if len(c.Server) > 0 {
+		servers := []string{c.Server}
+		for _, server := range c.Servers {
+			if server != c.Server {
+				servers = append(servers, server)
+			}
+		}
+		c.Servers = servers
+	}
+	if len(c.Servers) == 0 {
 		return fmt.Errorf("authenticator server URL is mandatory")
 	}
+	allowed := make(map[string]string, len(radius.DefaultAllowedAttributes)+len(c.AllowedAttributes))
+	for name, kind := range radius.DefaultAllowedAttributes {
+		allowed[name] = kind
+	}
+	for name, kind := range c.AllowedAttributes {
+		switch kind {
+		case radius.StringType, radius.IntegerType, radius.IPAddrType, radius.OctetsType:
+			allowed[name] = kind
+		default:
+			return fmt.Errorf("unknown type %s for allowed attribute %s", kind, name)
+		}
+	}
+	c.AllowedAttributes = allowed
+	if c.Retries < 0 {
+		return fmt.Errorf("authenticator retries cannot be negative")
+	}
+	for _, server := range c.Servers {
+		if _, err := url.Parse(server); err != nil {
+			return fmt.Errorf("invalid authenticator server URL %s: %w", server, err)
+		}
+	}
+	if c.Auth == HMACAuth && len(c.SigningSecret) == 0 {
+		return fmt.Errorf("authenticator signing secret is mandatory with hmac authentication")
+	}
+	if len(c.TokenFile) > 0 {
+		token, err := readToken(c.TokenFile)
+		if err != nil {
+			return err
+		}
+		c.Token = token
+	}
+	if len(c.CA) > 0 && !pki.IsPEM(c.CA) {
+		c.caFile = c.CA
+	}
+	if len(c.Certificate) > 0 && !pki.IsPEM(c.Certificate) {
+		c.certificateFile = c.Certificate
+	}
+	if len(c.Key) > 0 && !pki.IsPEM(c.Key) {
+		c.keyFile = c.Key
+	}
 	if len(c.CA) > 0 {
-		if !strings.Contains(c.CA, "BEGIN CERTIFICATE") {
-			if !common.FileExists(c.CA) {
-				return fmt.Errorf("ca is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.CA); err != nil {
-				return fmt.Errorf("cannot reqd CA file: %s", err)
-			} else {
-				c.CA = string(content)
-			}
+		ca, err := pki.LoadCertificates("ca", c.CA)
+		if err != nil {
+			return err
 		}
+		c.CA = ca
 	}
 	if len(c.Certificate) > 0 {
-		if !strings.Contains(c.Certificate, "BEGIN CERTIFICATE") {
-			if !common.FileExists(c.Certificate) {
-				return fmt.Errorf("certificate is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.Certificate); err != nil {
-				return fmt.Errorf("cannot reqd certificate file: %s", err)
-			} else {
-				c.Certificate = string(content)
-			}
+		certificate, err := pki.LoadCertificates("certificate", c.Certificate)
+		if err != nil {
+			return err
 		}
+		c.Certificate = certificate
 	}
 	if len(c.Key) > 0 {
-		if !strings.Contains(c.Key, "BEGIN RSA PRIVATE KEY") {
-			if !common.FileExists(c.Key) {
-				return fmt.Errorf("key is not a PEM string nor a valid file")
-			}
-			if content, err := ioutil.ReadFile(c.Key); err != nil {
-				return fmt.Errorf("cannot reqd key file: %s", err)
-			} else {
-				c.Key = string(content)
-			}
+		key, err := pki.LoadKey(c.Key, c.KeyPassphraseFile)
+		if err != nil {
+			return err
+		}
+		c.Key = key
+	}
+	if len(c.Certificate) > 0 && len(c.Key) > 0 {
+		if err := pki.CheckKeyPair(c.Certificate, c.Key); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// readToken returns the token stored in file
+func readToken(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read authenticator token file: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if len(token) == 0 {
+		return "", fmt.Errorf("authenticator token file %s is empty", file)
+	}
+	return token, nil
+}
+
+// MaxCallDuration returns the longest time a call can take, with every server timing out on every retry
+func (c *Configuration) MaxCallDuration() time.Duration {
+	duration := time.Duration(c.Retries+1) * time.Duration(len(c.Servers)) * c.Timeout
+	for attempt := 1; attempt <= c.Retries; attempt++ {
+		duration += c.retryWait(attempt)
+	}
+	return duration
+}
+
+// retryWait returns the exponential backoff before retry attempt, without jitter
+func (c *Configuration) retryWait(attempt int) time.Duration {
+	wait := c.RetryWait << (attempt - 1)
+	if wait <= 0 || wait > c.RetryMaxWait {
+		wait = c.RetryMaxWait
+	}
+	return wait
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/local/token"
+	"github.com/COSAE-FR/ripradius/pkg/pki"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// credentials are the TLS material and token sent to the authenticators
+type credentials struct {
+	certificates []tls.Certificate
+	roots        *x509.CertPool
+	token        string
+	signingKey   []byte
+}
+
+func newCredentials(config *Configuration) (*credentials, error) {
+	creds := &credentials{token: config.Token}
+	if config.Auth == HMACAuth {
+		key, err := token.SigningKey(config.SigningSecret)
+		if err != nil {
+			return nil, err
+		}
+		creds.signingKey = key
+	}
+	if len(config.Certificate) > 0 && len(config.Key) > 0 {
+		cert, err := tls.X509KeyPair([]byte(config.Certificate), []byte(config.Key))
+		if err != nil {
+			return nil, err
+		}
+		creds.certificates = []tls.Certificate{cert}
+	}
+	if len(config.CA) > 0 {
+		creds.roots = x509.NewCertPool()
+		if !creds.roots.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, fmt.Errorf("no certificate found in ca")
+		}
+	}
+	return creds, nil
+}
+
+// reloadingTransport sends requests with the current transport, which can be replaced at any time.
+// Requests already sent keep the transport they started with.
+type reloadingTransport struct {
+	current atomic.Pointer[http.Transport]
+}
+
+func (t *reloadingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(request)
+}
+
+func (t *reloadingTransport) swap(transport *http.Transport) {
+	if previous := t.current.Swap(transport); previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// fileState identifies a version of a watched file
+type fileState struct {
+	modified time.Time
+	size     int64
+}
+
+func statFile(file string) fileState {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modified: info.ModTime(), size: info.Size()}
+}
+
+// watchedFiles returns the files the credentials are read from
+func (c *Client) watchedFiles() []string {
+	var files []string
+	for _, file := range []string{c.config.TokenFile, c.config.caFile, c.config.certificateFile, c.config.keyFile, c.config.KeyPassphraseFile} {
+		if len(file) > 0 {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Start watches the credential files, reloading them when they change
+func (c *Client) Start() error {
+	files := c.watchedFiles()
+	if c.config.ReloadInterval <= 0 || len(files) == 0 {
+		return nil
+	}
+	states := make(map[string]fileState, len(files))
+	for _, file := range files {
+		states[file] = statFile(file)
+	}
+	c.done = make(chan struct{})
+	go func(done chan struct{}) {
+		ticker := time.NewTicker(c.config.ReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				changed := false
+				for _, file := range files {
+					if state := statFile(file); state != states[file] {
+						states[file] = state
+						changed = true
+					}
+				}
+				if changed {
+					if err := c.Reload(); err != nil {
+						log.Errorf("Cannot reload authenticator credentials, keeping the current ones: %s", err)
+					}
+				}
+			}
+		}
+	}(c.done)
+	return nil
+}
+
+// Stop stops watching the credential files
+func (c *Client) Stop() error {
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+	return nil
+}
+
+// Reload reads the credential files again and uses them for the next requests
+func (c *Client) Reload() error {
+	config := *c.config
+	if len(config.TokenFile) > 0 {
+		token, err := readToken(config.TokenFile)
+		if err != nil {
+			return err
+		}
+		config.Token = token
+	}
+	if len(config.caFile) > 0 {
+		ca, err := pki.LoadCertificates("ca", config.caFile)
+		if err != nil {
+			return err
+		}
+		config.CA = ca
+	}
+	if len(config.certificateFile) > 0 {
+		certificate, err := pki.LoadCertificates("certificate", config.certificateFile)
+		if err != nil {
+			return err
+		}
+		config.Certificate = certificate
+	}
+	if len(config.keyFile) > 0 {
+		key, err := pki.LoadKey(config.keyFile, config.KeyPassphraseFile)
+		if err != nil {
+			return err
+		}
+		config.Key = key
+	}
+	if len(config.Certificate) > 0 && len(config.Key) > 0 {
+		if err := pki.CheckKeyPair(config.Certificate, config.Key); err != nil {
+			return err
+		}
+	}
+	creds, err := newCredentials(&config)
+	if err != nil {
+		return err
+	}
+	c.credentials.Store(creds)
+	for _, u := range c.upstreams {
+		u.transport.swap(u.newTransport(&config, creds))
+	}
+	log.Infof("Authenticator credentials reloaded")
+	return nil
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bearerServer is an authenticator recording the last Authorization header received
+type bearerServer struct {
+	*fakeServer
+	last string
+	sync.Mutex
+}
+
+func newBearerServer(t *testing.T) *bearerServer {
+	t.Helper()
+	server := &bearerServer{}
+	server.fakeServer = newFakeServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		server.Lock()
+		server.last = r.Header.Get("Authorization")
+		server.Unlock()
+		status(http.StatusOK)(w, r, call)
+	})
+	return server
+}
+
+// Bearer sends a request with client and returns the Authorization header received
+func (s *bearerServer) Bearer(t *testing.T, client *Client) string {
+	t.Helper()
+	if _, err := client.GetStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.last
+}
+
+func writeToken(t *testing.T, file string, token string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name       string
+		newToken   func(t *testing.T, file string)
+		wantErr    bool
+		wantBearer string
+	}{
+		{
+			name:       "token changed",
+			newToken:   func(t *testing.T, file string) { writeToken(t, file, "second token") },
+			wantBearer: "Bearer second token",
+		},
+		{
+			name:       "empty token file",
+			newToken:   func(t *testing.T, file string) { writeToken(t, file, "") },
+			wantErr:    true,
+			wantBearer: "Bearer first token",
+		},
+		{
+			name: "token file removed",
+			newToken: func(t *testing.T, file string) {
+				if err := os.Remove(file); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:    true,
+			wantBearer: "Bearer first token",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "token")
+			writeToken(t, file, "first token")
+			server := newBearerServer(t)
+			client := newTestClient(t, Configuration{TokenFile: file}, server.fakeServer)
+			if bearer := server.Bearer(t, client); bearer != "Bearer first token" {
+				t.Fatalf("got %q, want %q", bearer, "Bearer first token")
+			}
+			test.newToken(t, file)
+			if err := client.Reload(); (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			// A failed reload keeps the current credentials
+			if bearer := server.Bearer(t, client); bearer != test.wantBearer {
+				t.Fatalf("got %q, want %q", bearer, test.wantBearer)
+			}
+		})
+	}
+}
+
+func TestReloadWatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   time.Duration
+		wantBearer string
+	}{
+		{name: "changed file reloaded", interval: 10 * time.Millisecond, wantBearer: "Bearer second token"},
+		{name: "reload disabled", interval: -1, wantBearer: "Bearer first token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "token")
+			writeToken(t, file, "first token")
+			server := newBearerServer(t)
+			client := newTestClient(t, Configuration{TokenFile: file}, server.fakeServer)
+			client.config.ReloadInterval = test.interval
+			if err := client.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = client.Stop()
+			}()
+			writeToken(t, file, "second token")
+			deadline := time.Now().Add(200 * time.Millisecond)
+			bearer := server.Bearer(t, client)
+			for bearer != test.wantBearer && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+				bearer = server.Bearer(t, client)
+			}
+			if bearer != test.wantBearer {
+				t.Fatalf("got %q, want %q", bearer, test.wantBearer)
+			}
+			// The token is still the expected one once the watch had time to run
+			time.Sleep(50 * time.Millisecond)
+			if bearer := server.Bearer(t, client); bearer != test.wantBearer {
+				t.Fatalf("got %q after a while, want %q", bearer, test.wantBearer)
+			}
+		})
+	}
+}
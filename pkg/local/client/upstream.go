@@ -0,0 +1,138 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	"github.com/COSAE-FR/ripradius/pkg/local/token"
+	"github.com/COSAE-FR/ripradius/pkg/utils"
+	"github.com/COSAE-FR/riputils/common"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	FailoverStrategy   = "failover"
+	RoundRobinStrategy = "round-robin"
+)
+
+const (
+	TokenAuth = "token"
+	HMACAuth  = "hmac"
+)
+
+// upstream is an authenticator server and its health
+type upstream struct {
+	url         string
+	scheme      string
+	client      *resty.Client
+	transport   *reloadingTransport
+	failures    int
+	lastError   string
+	lastFailure time.Time
+	lastSuccess time.Time
+	sync.Mutex
+}
+
+func newUpstream(config *Configuration, server string, creds *atomic.Pointer[credentials]) (*upstream, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	up := &upstream{url: server, scheme: u.Scheme, transport: &reloadingTransport{}}
+	up.transport.swap(up.newTransport(config, creds.Load()))
+	client := resty.New()
+	client.SetBaseURL(server)
+	client.SetHeaders(map[string]string{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+		"User-Agent":   fmt.Sprintf("%s/%s", utils.Name, utils.Version),
+	})
+	client.SetTransport(up.transport)
+	if config.Auth == HMACAuth {
+		client.SetPreRequestHook(func(_ *resty.Client, r *http.Request) error {
+			return token.SignRequest(creds.Load().signingKey, r, time.Now())
+		})
+	} else {
+		client.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+			if bearer := creds.Load().token; len(bearer) > 0 {
+				r.SetAuthToken(bearer)
+			}
+			return nil
+		})
+	}
+	up.client = client
+	return up, nil
+}
+
+// newTransport returns an HTTP transport using the given credentials
+func (u *upstream) newTransport(config *Configuration, creds *credentials) *http.Transport {
+	transport := &http.Transport{}
+	if u.scheme == "https" {
+		transport.TLSClientConfig = &tls.Config{
+			Certificates: creds.certificates,
+			RootCAs:      creds.roots,
+		}
+	}
+	if len(config.SourceInterface) > 0 {
+		ip, err := common.GetIPForInterface(config.SourceInterface)
+		if err == nil {
+			dialer := &net.Dialer{
+				Timeout:   10 * time.Second,
+				LocalAddr: &net.TCPAddr{IP: ip.IP.To4()},
+			}
+			transport.DialContext = dialer.DialContext
+		} else {
+			log.Errorf("Cannot get interface %s IP: %s", config.SourceInterface, err)
+		}
+	}
+	return transport
+}
+
+// available reports if the server can be tried, a failed server is skipped during delay
+func (u *upstream) available(delay time.Duration) bool {
+	u.Lock()
+	defer u.Unlock()
+	return u.failures == 0 || time.Since(u.lastFailure) > delay
+}
+
+func (u *upstream) success() {
+	u.Lock()
+	defer u.Unlock()
+	u.failures = 0
+	u.lastSuccess = time.Now()
+}
+
+func (u *upstream) failure(err error) {
+	u.Lock()
+	defer u.Unlock()
+	u.failures++
+	u.lastError = err.Error()
+	u.lastFailure = time.Now()
+}
+
+func (u *upstream) status(delay time.Duration) binding.UpstreamServerStatus {
+	u.Lock()
+	defer u.Unlock()
+	status := binding.UpstreamServerStatus{
+		URL:       u.url,
+		Available: u.failures == 0 || time.Since(u.lastFailure) > delay,
+		Failures:  u.failures,
+		LastError: u.lastError,
+	}
+	if !u.lastFailure.IsZero() {
+		lastFailure := u.lastFailure
+		status.LastFailure = &lastFailure
+	}
+	if !u.lastSuccess.IsZero() {
+		lastSuccess := u.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	return status
+}
@@ -0,0 +1,203 @@
+package coa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	DisabledError        = errors.New("dynamic authorization disabled")
+	UnknownSecretError   = errors.New("no secret for NAS")
+	RequestRejectedError = errors.New("request rejected by NAS")
+	NoAnswerError        = errors.New("no answer from NAS")
+)
+
+// SecretLookup returns the secret of a NAS known otherwise, like a dynamic client
+type SecretLookup func(ip string) (string, bool)
+
+// Sender sends CoA-Request and Disconnect-Request packets (RFC 5176) to the NAS of a session
+type Sender struct {
+	config     *Configuration
+	lookup     SecretLookup
+	identifier atomic.Uint32
+	log        *log.Entry
+}
+
+func New(logger *log.Entry, config *Configuration) (*Sender, error) {
+	sender := &Sender{
+		config: config,
+		log:    logger.WithField("component", "coa"),
+	}
+	sender.identifier.Store(uint32(time.Now().UnixNano()))
+	return sender, nil
+}
+
+// SetSecretLookup sets the function resolving the secrets of the NAS without configured secret
+func (s *Sender) SetSecretLookup(lookup SecretLookup) {
+	s.lookup = lookup
+}
+
+// Enabled reports if requests can be sent
+func (s *Sender) Enabled() bool {
+	return s != nil && s.config.Enabled
+}
+
+// OnChange returns the action for sessions of a user whose authorization changed
+func (s *Sender) OnChange() string {
+	if !s.Enabled() {
+		return NoAction
+	}
+	return s.config.OnChange
+}
+
+// OnRevoke returns the action for sessions of a revoked user
+func (s *Sender) OnRevoke() string {
+	if !s.Enabled() {
+		return NoAction
+	}
+	return s.config.OnRevoke
+}
+
+// Disconnect asks the NAS to end the session
+func (s *Sender) Disconnect(ctx context.Context, target session.Session) error {
+	return s.send(ctx, target, radius.DisconnectRequest, nil)
+}
+
+// Change asks the NAS to apply the authorization attributes to the session
+func (s *Sender) Change(ctx context.Context, target session.Session, attributes radius.Attributes) error {
+	return s.send(ctx, target, radius.CoARequest, attributes)
+}
+
+// destination returns the address and secret of a NAS RADIUS client
+func (s *Sender) destination(nas string) (*net.UDPAddr, string, error) {
+	ip := net.ParseIP(nas).To4()
+	if ip == nil {
+		return nil, "", fmt.Errorf("invalid NAS IP address %s", nas)
+	}
+	port, secret := s.config.Port, ""
+	if client := s.config.client(ip); client != nil {
+		secret = client.Secret
+		if client.Port > 0 {
+			port = client.Port
+		}
+	}
+	if len(secret) == 0 && s.lookup != nil {
+		secret, _ = s.lookup(ip.String())
+	}
+	if len(secret) == 0 {
+		secret = s.config.Secret
+	}
+	if len(secret) == 0 {
+		return nil, "", fmt.Errorf("%w %s", UnknownSecretError, nas)
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, secret, nil
+}
+
+// identification returns the attributes identifying the session on the NAS
+func identification(target session.Session) radius.Attributes {
+	attributes := radius.Attributes{}
+	if len(target.ID) > 0 {
+		attributes = append(attributes, radius.Attribute{Name: "Acct-Session-Id", Value: target.ID})
+	}
+	if len(target.Username) > 0 {
+		attributes = append(attributes, radius.Attribute{Name: "User-Name", Value: target.Username})
+	}
+	if mac, err := radius.ParseMAC(target.Mac); err == nil {
+		// RFC 3580 format
+		attributes = append(attributes, radius.Attribute{Name: "Calling-Station-Id", Value: radius.FormatMAC(mac, radius.HyphenFormat, true)})
+	}
+	if ip := net.ParseIP(target.Nas); ip != nil && ip.To4() != nil {
+		attributes = append(attributes, radius.Attribute{Name: "NAS-IP-Address", Value: target.Nas})
+	}
+	if port, err := strconv.ParseUint(target.NasPort, 10, 32); err == nil {
+		attributes = append(attributes, radius.Attribute{Name: "NAS-Port", Value: strconv.FormatUint(port, 10)})
+	}
+	if len(target.FramedIP) > 0 {
+		attributes = append(attributes, radius.Attribute{Name: "Framed-IP-Address", Value: target.FramedIP})
+	}
+	return attributes
+}
+
+func (s *Sender) send(ctx context.Context, target session.Session, code byte, attributes radius.Attributes) error {
+	if !s.Enabled() {
+		return DisabledError
+	}
+	// The NAS-IP-Address may be a management address or behind NAT, send to where the accounting came from
+	address, secret, err := s.destination(target.Client())
+	if err != nil {
+		return err
+	}
+	request := radius.DynamicRequest{
+		Code:       code,
+		Identifier: byte(s.identifier.Add(1)),
+		Attributes: append(identification(target), attributes...),
+	}
+	packet, err := request.Encode(secret)
+	if err != nil {
+		return err
+	}
+	logger := s.log.WithFields(map[string]interface{}{
+		"user":    target.Username,
+		"src_mac": target.Mac,
+		"src_ip":  target.Nas,
+		"session": target.ID,
+	})
+	conn, err := net.DialUDP("udp4", nil, address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	answer := make([]byte, 4096)
+	// Retransmissions reuse the same packet and identifier
+	for attempt := 0; attempt <= s.config.Retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(s.config.Timeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		_ = conn.SetDeadline(deadline)
+		logger.Tracef("Sending dynamic authorization request %d to %s (attempt %d)", code, address, attempt+1)
+		if _, err := conn.Write(packet); err != nil {
+			return err
+		}
+		for {
+			n, err := conn.Read(answer)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return err
+			}
+			response, err := radius.DecodeDynamicResponse(answer[:n], packet, secret)
+			if err != nil {
+				// Stray or forged answer, keep waiting for the right one
+				logger.Debugf("Ignoring answer from %s: %s", address, err)
+				continue
+			}
+			if !response.Acknowledged() {
+				cause := "no Error-Cause"
+				if response.ErrorCause > 0 {
+					cause = radius.ErrorCause(response.ErrorCause)
+				}
+				logger.Infof("Dynamic authorization request %d rejected: %s", code, cause)
+				return fmt.Errorf("%w: %s", RequestRejectedError, cause)
+			}
+			logger.Debugf("Dynamic authorization request %d acknowledged", code)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", NoAnswerError, address)
+}
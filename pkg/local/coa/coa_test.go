@@ -0,0 +1,212 @@
+package coa
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
+	"github.com/COSAE-FR/ripradius/pkg/radius"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "testing123"
+
+// answer returns the response to a request packet, signed with secret
+func answer(request []byte, code byte, secret string, attributes []byte) []byte {
+	response := []byte{code, request[1], 0, 0}
+	response = append(response, request[4:20]...)
+	response = append(response, attributes...)
+	binary.BigEndian.PutUint16(response[2:4], uint16(len(response)))
+	hash := md5.New()
+	hash.Write(response)
+	hash.Write([]byte(secret))
+	copy(response[4:20], hash.Sum(nil))
+	return response
+}
+
+// fakeNAS answers dynamic authorization requests with respond, dropping them when it returns nil
+type fakeNAS struct {
+	conn     *net.UDPConn
+	received atomic.Int32
+}
+
+func newFakeNAS(t *testing.T, respond func(request []byte, attempt int) []byte) *fakeNAS {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nas := &fakeNAS{conn: conn}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			attempt := int(nas.received.Add(1))
+			if response := respond(append([]byte{}, buffer[:n]...), attempt); response != nil {
+				_, _ = conn.WriteToUDP(response, from)
+			}
+		}
+	}()
+	return nas
+}
+
+func (n *fakeNAS) port() uint16 {
+	return uint16(n.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func newSender(t *testing.T, port uint16) *Sender {
+	t.Helper()
+	config := &Configuration{
+		Enabled: true,
+		Port:    port,
+		Timeout: 200 * time.Millisecond,
+		Retries: 1,
+		Secret:  testSecret,
+	}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := New(log.NewEntry(log.New()), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+// testSession is accounted from the loopback, while its NAS-IP-Address is not reachable
+var testSession = session.Session{
+	ID:       "0000001",
+	Username: "alice",
+	Mac:      "aa:bb:cc:dd:ee:ff",
+	Nas:      "192.0.2.1",
+	Source:   "127.0.0.1",
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		respond      func(request []byte, attempt int) []byte
+		send         func(sender *Sender) error
+		wantErr      error
+		wantReceived int32
+	}{
+		{
+			name: "disconnect ACK",
+			respond: func(request []byte, _ int) []byte {
+				if request[0] != radius.DisconnectRequest {
+					return nil
+				}
+				return answer(request, radius.DisconnectACK, testSecret, nil)
+			},
+			send: func(sender *Sender) error {
+				return sender.Disconnect(context.Background(), testSession)
+			},
+			wantReceived: 1,
+		},
+		{
+			name: "CoA ACK",
+			respond: func(request []byte, _ int) []byte {
+				if request[0] != radius.CoARequest {
+					return nil
+				}
+				return answer(request, radius.CoAACK, testSecret, nil)
+			},
+			send: func(sender *Sender) error {
+				return sender.Change(context.Background(), testSession, radius.Attributes{{Name: "Tunnel-Private-Group-Id", Value: "10"}})
+			},
+			wantReceived: 1,
+		},
+		{
+			name: "CoA NAK with Error-Cause",
+			respond: func(request []byte, _ int) []byte {
+				// Session Context Not Found
+				return answer(request, radius.CoANAK, testSecret, binary.BigEndian.AppendUint32([]byte{101, 6}, 503))
+			},
+			send: func(sender *Sender) error {
+				return sender.Change(context.Background(), testSession, nil)
+			},
+			wantErr:      RequestRejectedError,
+			wantReceived: 1,
+		},
+		{
+			name: "retransmission after a lost request",
+			respond: func(request []byte, attempt int) []byte {
+				if attempt == 1 {
+					return nil
+				}
+				return answer(request, radius.DisconnectACK, testSecret, nil)
+			},
+			send: func(sender *Sender) error {
+				return sender.Disconnect(context.Background(), testSession)
+			},
+			wantReceived: 2,
+		},
+		{
+			name: "wrong NAS secret",
+			respond: func(request []byte, _ int) []byte {
+				return answer(request, radius.DisconnectACK, "other secret", nil)
+			},
+			send: func(sender *Sender) error {
+				return sender.Disconnect(context.Background(), testSession)
+			},
+			wantErr:      NoAnswerError,
+			wantReceived: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nas := newFakeNAS(t, test.respond)
+			err := test.send(newSender(t, nas.port()))
+			if test.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if received := nas.received.Load(); received != test.wantReceived {
+				t.Fatalf("NAS received %d requests, want %d", received, test.wantReceived)
+			}
+		})
+	}
+}
+
+func TestSendIdentification(t *testing.T) {
+	requests := make(chan []byte, 1)
+	nas := newFakeNAS(t, func(request []byte, _ int) []byte {
+		requests <- request
+		return answer(request, radius.DisconnectACK, testSecret, nil)
+	})
+	if err := newSender(t, nas.port()).Disconnect(context.Background(), testSession); err != nil {
+		t.Fatal(err)
+	}
+	request := <-requests
+	// The request reached the accounting source, and still identifies the NAS by its NAS-IP-Address
+	for attributes := request[20:]; len(attributes) > 1; attributes = attributes[attributes[1]:] {
+		if attributes[0] == 4 {
+			if !net.IP(attributes[2:attributes[1]]).Equal(net.ParseIP(testSession.Nas)) {
+				t.Fatalf("got NAS-IP-Address %v, want %s", net.IP(attributes[2:attributes[1]]), testSession.Nas)
+			}
+			return
+		}
+	}
+	t.Fatal("missing NAS-IP-Address")
+}
+
+func TestSendDisabled(t *testing.T) {
+	sender := newSender(t, 3799)
+	sender.config.Enabled = false
+	if err := sender.Disconnect(context.Background(), testSession); !errors.Is(err, DisabledError) {
+		t.Fatalf("got error %v, want %v", err, DisabledError)
+	}
+}
@@ -0,0 +1,75 @@
+package coa
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"github.com/go-playground/validator/v10"
+	"net"
+	"strings"
+	"time"
+)
+
+// Automatic actions on users changed or revoked by a background refresh
+const (
+	NoAction         = "none"
+	CoAAction        = "coa"
+	DisconnectAction = "disconnect"
+)
+
+// NAS holds the dynamic authorization parameters of a NAS or a network of NAS
+type NAS struct {
+	Network string `yaml:"network" validate:"cidrv4|ipv4"`
+	Secret  string `yaml:"secret"`
+	Port    uint16 `yaml:"port"`
+	network *net.IPNet
+}
+
+type Configuration struct {
+	Enabled bool `yaml:"enabled"`
+	// Default dynamic authorization port of the NAS
+	Port    uint16        `yaml:"port" default:"3799"`
+	Timeout time.Duration `yaml:"timeout" default:"3s"`
+	Retries int           `yaml:"retries" default:"2"`
+	// Default NAS secret, the dynamic client or Freeradius secret when empty
+	Secret string `yaml:"secret"`
+	// Per-NAS secrets and ports, the first matching entry is used
+	Clients []NAS `yaml:"clients" validate:"dive"`
+	// Action on the active sessions of a user whose VLAN or role changed
+	OnChange string `yaml:"on_change" default:"none" validate:"oneof=none coa disconnect"`
+	// Action on the active sessions of a user refused by the authenticator
+	OnRevoke string `yaml:"on_revoke" default:"none" validate:"oneof=none disconnect"`
+}
+
+func (c *Configuration) Check() error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	if err := validator.New().Struct(c); err != nil {
+		return fmt.Errorf("invalid dynamic authorization configuration: %w", err)
+	}
+	if c.Timeout <= 0 || c.Retries < 0 {
+		return fmt.Errorf("dynamic authorization timeout must be positive")
+	}
+	for i := range c.Clients {
+		network := c.Clients[i].Network
+		if !strings.Contains(network, "/") {
+			network = network + "/32"
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return fmt.Errorf("invalid dynamic authorization network %s: %w", c.Clients[i].Network, err)
+		}
+		c.Clients[i].network = ipNet
+	}
+	return nil
+}
+
+// client returns the first NAS entry matching the IP
+func (c *Configuration) client(ip net.IP) *NAS {
+	for i := range c.Clients {
+		if c.Clients[i].network != nil && c.Clients[i].network.Contains(ip) {
+			return &c.Clients[i]
+		}
+	}
+	return nil
+}
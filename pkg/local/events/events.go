@@ -0,0 +1,156 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	AuthorizeEvent = "authorize"
+	CacheEvent     = "cache"
+	UpstreamEvent  = "upstream"
+	PostAuthEvent  = "post-auth"
+)
+
+// Event is a step of an authentication, or a change of the daemon state
+type Event struct {
+	Time     time.Time              `json:"time"`
+	Type     string                 `json:"type"`
+	Username string                 `json:"username,omitempty"`
+	Mac      string                 `json:"mac,omitempty"`
+	Nas      string                 `json:"nas,omitempty"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// Filter selects events, empty fields match every event.
+// Events about no user, MAC nor NAS, like upstream state changes, always match.
+type Filter struct {
+	Username string
+	// Canonical MAC address
+	Mac   string
+	Nas   string
+	Types []string
+}
+
+// Match reports if the event is selected by the filter
+func (f Filter) Match(event Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, eventType := range f.Types {
+			if eventType == event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(event.Username) == 0 && len(event.Mac) == 0 && len(event.Nas) == 0 {
+		return true
+	}
+	if len(f.Username) > 0 && !strings.EqualFold(f.Username, event.Username) {
+		return false
+	}
+	if len(f.Mac) > 0 && f.Mac != event.Mac {
+		return false
+	}
+	if len(f.Nas) > 0 && f.Nas != event.Nas {
+		return false
+	}
+	return true
+}
+
+// Subscription receives the events selected by its filter
+type Subscription struct {
+	events  chan Event
+	filter  Filter
+	dropped int
+}
+
+// Events returns the channel of the subscription, closed when the bus disconnects it
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Bus dispatches events to the subscriptions, dropping them for the subscribers too slow to follow
+type Bus struct {
+	subscriptions map[*Subscription]bool
+	bufferSize    int
+	sync.Mutex
+}
+
+func New(bufferSize int) *Bus {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Bus{
+		subscriptions: make(map[*Subscription]bool),
+		bufferSize:    bufferSize,
+	}
+}
+
+// Publish sends the event to the matching subscriptions without blocking
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.Lock()
+	defer b.Unlock()
+	for subscription := range b.subscriptions {
+		if !subscription.filter.Match(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped++
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events selected by the filter
+func (b *Bus) Subscribe(filter Filter) *Subscription {
+	subscription := &Subscription{
+		events: make(chan Event, b.bufferSize),
+		filter: filter,
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.subscriptions[subscription] = true
+	return subscription
+}
+
+// Unsubscribe stops the subscription and returns the number of events dropped for it
+func (b *Bus) Unsubscribe(subscription *Subscription) int {
+	b.Lock()
+	defer b.Unlock()
+	if b.subscriptions[subscription] {
+		delete(b.subscriptions, subscription)
+		close(subscription.events)
+	}
+	return subscription.dropped
+}
+
+// Disconnect stops every subscription, the bus stays usable
+func (b *Bus) Disconnect() {
+	b.Lock()
+	defer b.Unlock()
+	for subscription := range b.subscriptions {
+		delete(b.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// Subscribers returns the number of subscriptions
+func (b *Bus) Subscribers() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.subscriptions)
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"time"
+)
+
+type Configuration struct {
+	// Consecutive upstream failures before going offline
+	FailureThreshold int `yaml:"failure_threshold" default:"3"`
+	// Consecutive upstream successes before going back online
+	RecoveryThreshold int `yaml:"recovery_threshold" default:"2"`
+	// Interval between two upstream status probes
+	ProbeInterval time.Duration `yaml:"probe_interval" default:"30s"`
+}
+
+func (c *Configuration) Check() error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	if c.FailureThreshold < 1 || c.RecoveryThreshold < 1 {
+		return fmt.Errorf("health failure and recovery thresholds must be at least 1")
+	}
+	if c.ProbeInterval <= 0 {
+		return fmt.Errorf("health probe interval must be positive")
+	}
+	return nil
+}
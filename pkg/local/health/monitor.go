@@ -0,0 +1,177 @@
+package health
+
+import (
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	Online State = "online"
+	// Recovering is offline, waiting for enough upstream successes to go back online
+	Recovering State = "recovering"
+	Offline    State = "offline"
+)
+
+// ChangeHandler is called on every state transition
+type ChangeHandler func(from State, to State)
+
+// Monitor is a circuit breaker tracking the upstream authenticator state
+type Monitor struct {
+	config    *Configuration
+	probe     func() error
+	state     State
+	since     time.Time
+	failures  int
+	successes int
+	lastError string
+	handlers  []ChangeHandler
+	done      chan bool
+	log       *log.Entry
+	sync.Mutex
+}
+
+func New(logger *log.Entry, config *Configuration, probe func() error) *Monitor {
+	return &Monitor{
+		config: config,
+		probe:  probe,
+		state:  Online,
+		since:  time.Now(),
+		log:    logger.WithField("component", "health"),
+	}
+}
+
+// OnChange registers a handler called on every state transition
+func (m *Monitor) OnChange(handler ChangeHandler) {
+	m.Lock()
+	defer m.Unlock()
+	m.handlers = append(m.handlers, handler)
+}
+
+// setState must be called with the lock held, the returned function calls the handlers and must be called without it
+func (m *Monitor) setState(state State) func() {
+	if state == m.state {
+		return func() {}
+	}
+	previous := m.state
+	m.state = state
+	m.since = time.Now()
+	switch state {
+	case Offline:
+		m.log.Warnf("Upstream state changed from %s to %s after %d failures: %s", previous, state, m.failures, m.lastError)
+	default:
+		m.log.Infof("Upstream state changed from %s to %s", previous, state)
+	}
+	handlers := append([]ChangeHandler(nil), m.handlers...)
+	return func() {
+		for _, handler := range handlers {
+			handler(previous, state)
+		}
+	}
+}
+
+// Report records the result of an upstream call, err is nil when the upstream answered
+func (m *Monitor) Report(err error) {
+	if err != nil {
+		m.Failure(err)
+	} else {
+		m.Success()
+	}
+}
+
+func (m *Monitor) Success() {
+	var notify []func()
+	m.Lock()
+	m.failures = 0
+	switch m.state {
+	case Offline:
+		m.successes = 1
+		notify = append(notify, m.setState(Recovering))
+	case Recovering:
+		m.successes++
+	}
+	if m.state == Recovering && m.successes >= m.config.RecoveryThreshold {
+		m.successes = 0
+		notify = append(notify, m.setState(Online))
+	}
+	m.Unlock()
+	for _, handler := range notify {
+		handler()
+	}
+}
+
+func (m *Monitor) Failure(err error) {
+	notify := func() {}
+	m.Lock()
+	m.failures++
+	m.successes = 0
+	m.lastError = err.Error()
+	switch m.state {
+	case Online:
+		if m.failures >= m.config.FailureThreshold {
+			notify = m.setState(Offline)
+		}
+	case Recovering:
+		notify = m.setState(Offline)
+	}
+	m.Unlock()
+	notify()
+}
+
+// Available reports if upstream calls should be tried, they are skipped while offline until the probe succeeds
+func (m *Monitor) Available() bool {
+	return m.probe == nil || m.State() != Offline
+}
+
+func (m *Monitor) State() State {
+	m.Lock()
+	defer m.Unlock()
+	return m.state
+}
+
+func (m *Monitor) Status() binding.HealthStatus {
+	m.Lock()
+	defer m.Unlock()
+	return binding.HealthStatus{
+		State:     string(m.state),
+		Since:     m.since,
+		Failures:  m.failures,
+		LastError: m.lastError,
+	}
+}
+
+// Start probes the upstream status at intervals
+func (m *Monitor) Start() error {
+	if m.probe == nil || m.done != nil {
+		return nil
+	}
+	m.done = make(chan bool)
+	go func(done chan bool) {
+		tick := time.NewTicker(m.config.ProbeInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				err := m.probe()
+				if err != nil {
+					m.log.Debugf("Upstream probe failed: %s", err)
+				}
+				m.Report(err)
+			}
+		}
+	}(m.done)
+	return nil
+}
+
+func (m *Monitor) Stop() error {
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package health
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var upstreamError = errors.New("connection refused")
+
+func newTestMonitor(t *testing.T, probe func() error) *Monitor {
+	t.Helper()
+	config := Configuration{FailureThreshold: 2, RecoveryThreshold: 2}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	return New(log.NewEntry(log.New()), &config, probe)
+}
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     []error
+		wantState   State
+		wantChanges []State
+	}{
+		{
+			name:      "failures below the threshold",
+			results:   []error{upstreamError, nil, upstreamError},
+			wantState: Online,
+		},
+		{
+			name:        "offline after consecutive failures",
+			results:     []error{upstreamError, upstreamError},
+			wantState:   Offline,
+			wantChanges: []State{Offline},
+		},
+		{
+			name:        "recovering after a success",
+			results:     []error{upstreamError, upstreamError, nil},
+			wantState:   Recovering,
+			wantChanges: []State{Offline, Recovering},
+		},
+		{
+			name:        "online after consecutive successes",
+			results:     []error{upstreamError, upstreamError, nil, nil},
+			wantState:   Online,
+			wantChanges: []State{Offline, Recovering, Online},
+		},
+		{
+			name:        "offline again on a failure while recovering",
+			results:     []error{upstreamError, upstreamError, nil, upstreamError},
+			wantState:   Offline,
+			wantChanges: []State{Offline, Recovering, Offline},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			monitor := newTestMonitor(t, nil)
+			var changes []State
+			monitor.OnChange(func(from State, to State) {
+				changes = append(changes, to)
+			})
+			for _, err := range test.results {
+				monitor.Report(err)
+			}
+			if state := monitor.State(); state != test.wantState {
+				t.Fatalf("got state %s, want %s", state, test.wantState)
+			}
+			if !reflect.DeepEqual(changes, test.wantChanges) {
+				t.Fatalf("got changes %v, want %v", changes, test.wantChanges)
+			}
+		})
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	// Without probe, nothing would bring the upstream back online
+	monitor := newTestMonitor(t, nil)
+	monitor.Report(upstreamError)
+	monitor.Report(upstreamError)
+	if !monitor.Available() {
+		t.Fatal("offline upstream without probe not available")
+	}
+	monitor = newTestMonitor(t, func() error { return nil })
+	monitor.Report(upstreamError)
+	monitor.Report(upstreamError)
+	if monitor.Available() {
+		t.Fatal("offline upstream with probe available")
+	}
+	monitor.Report(nil)
+	if !monitor.Available() {
+		t.Fatal("recovering upstream not available")
+	}
+}
+
+func TestHandlerUnlocked(t *testing.T) {
+	monitor := newTestMonitor(t, nil)
+	states := make(chan State, 1)
+	monitor.OnChange(func(from State, to State) {
+		// Handlers can read the monitor
+		states <- monitor.State()
+	})
+	done := make(chan struct{})
+	go func() {
+		monitor.Report(upstreamError)
+		monitor.Report(upstreamError)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("state handler deadlocked")
+	}
+	if state := <-states; state != Offline {
+		t.Fatalf("handler read state %s, want %s", state, Offline)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	probes := make(chan struct{}, 10)
+	monitor := newTestMonitor(t, func() error {
+		select {
+		case probes <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	monitor.config.ProbeInterval = 10 * time.Millisecond
+	monitor.Report(upstreamError)
+	monitor.Report(upstreamError)
+	if err := monitor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = monitor.Stop()
+	}()
+	deadline := time.After(time.Second)
+	for monitor.State() != Online {
+		select {
+		case <-probes:
+		case <-deadline:
+			t.Fatalf("got state %s after probes, want %s", monitor.State(), Online)
+		}
+	}
+}
+
+func TestConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Configuration
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "negative failure threshold", config: Configuration{FailureThreshold: -1}, wantErr: true},
+		{name: "negative recovery threshold", config: Configuration{RecoveryThreshold: -1}, wantErr: true},
+		{name: "negative probe interval", config: Configuration{ProbeInterval: -time.Second}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.Check(); (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package session
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"time"
+)
+
+type Configuration struct {
+	// Snapshot file, loaded at start and written at intervals and on shutdown
+	Path         string        `yaml:"path"`
+	SaveInterval time.Duration `yaml:"save_interval" default:"5m"`
+	// Stopped sessions are kept for this duration
+	Retention   time.Duration `yaml:"retention" default:"24h"`
+	MaxSessions int           `yaml:"max_sessions" default:"10000"`
+	// Accounting records are sent to the authenticator by batches, at least every flush interval
+	Forward       bool          `yaml:"forward"`
+	BatchSize     int           `yaml:"batch_size" default:"100"`
+	FlushInterval time.Duration `yaml:"flush_interval" default:"10s"`
+	// Records waiting for the authenticator, the oldest are dropped beyond this size
+	BufferSize int `yaml:"buffer_size" default:"10000"`
+}
+
+func (c *Configuration) Check() error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	if c.BatchSize <= 0 || c.BufferSize <= 0 || c.MaxSessions <= 0 {
+		return fmt.Errorf("session batch, buffer and table sizes must be positive")
+	}
+	if c.FlushInterval <= 0 || c.SaveInterval <= 0 {
+		return fmt.Errorf("session flush and save intervals must be positive")
+	}
+	return nil
+}
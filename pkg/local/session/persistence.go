@@ -0,0 +1,68 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type snapshot struct {
+	Saved    time.Time `json:"saved"`
+	Sessions []Session `json:"sessions"`
+	Pending  []Record  `json:"pending"`
+}
+
+func (s *Store) save() error {
+	s.Lock()
+	data := snapshot{Saved: time.Now(), Pending: append([]Record{}, s.pending...)}
+	for _, session := range s.sessions {
+		data.Sessions = append(data.Sessions, *session)
+	}
+	s.Unlock()
+	content, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0700); err != nil {
+		return err
+	}
+	tmp := s.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.config.Path); err != nil {
+		return err
+	}
+	s.log.Tracef("Session snapshot written with %d sessions and %d pending records", len(data.Sessions), len(data.Pending))
+	return nil
+}
+
+func (s *Store) load() error {
+	content, err := os.ReadFile(s.config.Path)
+	if os.IsNotExist(err) {
+		s.log.Debugf("No session snapshot at %s", s.config.Path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	data := snapshot{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	for i := range data.Sessions {
+		session := data.Sessions[i]
+		s.sessions[getSessionKey(session.ID, session.Nas, session.Mac)] = &session
+	}
+	s.prune()
+	if s.config.Forward {
+		s.pending = data.Pending
+		if overflow := len(s.pending) - s.config.BufferSize; overflow > 0 {
+			s.pending = s.pending[overflow:]
+		}
+	}
+	s.log.Debugf("Session snapshot from %s loaded with %d sessions and %d pending records", data.Saved.Format(time.RFC3339), len(s.sessions), len(s.pending))
+	return nil
+}
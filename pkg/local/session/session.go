@@ -0,0 +1,407 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Acct-Status-Type values
+const (
+	StartStatus         = "Start"
+	InterimStatus       = "Interim-Update"
+	StopStatus          = "Stop"
+	AccountingOnStatus  = "Accounting-On"
+	AccountingOffStatus = "Accounting-Off"
+)
+
+// Session is a network session of a user, built from its accounting records
+type Session struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Mac      string `json:"mac"`
+	Nas      string `json:"nas"`
+	// Source address of the accounting packets, where dynamic authorization requests are sent
+	Source   string `json:"source,omitempty"`
+	NasPort  string `json:"nas_port,omitempty"`
+	FramedIP string `json:"framed_ip,omitempty"`
+	VLAN     uint16 `json:"vlan"`
+	// Octets received from and sent to the user
+	InputBytes  uint64 `json:"input_bytes"`
+	OutputBytes uint64 `json:"output_bytes"`
+	// Duration in seconds, as reported by the NAS
+	Duration       uint32     `json:"duration"`
+	Started        time.Time  `json:"started"`
+	Updated        time.Time  `json:"updated"`
+	Stopped        *time.Time `json:"stopped,omitempty"`
+	TerminateCause string     `json:"terminate_cause,omitempty"`
+}
+
+// Active reports if the session is not stopped
+func (s Session) Active() bool {
+	return s.Stopped == nil
+}
+
+// Client returns the address of the NAS RADIUS client, the NAS-IP-Address for sessions without packet source
+func (s Session) Client() string {
+	if len(s.Source) > 0 {
+		return s.Source
+	}
+	return s.Nas
+}
+
+// Record is an accounting record, as received from Freeradius and forwarded to the authenticator
+type Record struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Session
+}
+
+// Status provides statistics for the session store
+type Status struct {
+	Active  int `json:"active"`
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	Dropped int `json:"dropped"`
+}
+
+// Forwarder sends accounting records to the authenticator
+type Forwarder func(ctx context.Context, records []Record) error
+
+// stopFlushTimeout bounds the last forwarding of the pending records on shutdown
+const stopFlushTimeout = 5 * time.Second
+
+// Store is the session table, with the accounting records waiting to be forwarded
+type Store struct {
+	sessions  map[string]*Session
+	pending   []Record
+	dropped   int
+	forwarder Forwarder
+	config    *Configuration
+	done      chan struct{}
+	wg        sync.WaitGroup
+	log       *log.Entry
+	sync.Mutex
+}
+
+func getSessionKey(id string, nas string, mac string) string {
+	return fmt.Sprintf("%s|%s|%s", strings.ToLower(nas), strings.ToLower(mac), id)
+}
+
+func New(logger *log.Entry, config *Configuration) (*Store, error) {
+	store := &Store{
+		sessions: make(map[string]*Session),
+		config:   config,
+		log:      logger.WithField("component", "sessions"),
+	}
+	if len(config.Path) > 0 {
+		if err := store.load(); err != nil {
+			store.log.Errorf("Cannot load session snapshot %s: %s", config.Path, err)
+		}
+	} else if config.Forward {
+		store.log.Warn("No session snapshot path, accounting records not forwarded at shutdown will be lost")
+	}
+	return store, nil
+}
+
+// SetForwarder sets the function sending accounting records to the authenticator
+func (s *Store) SetForwarder(forwarder Forwarder) {
+	s.forwarder = forwarder
+}
+
+// Update applies an accounting record to the session table and queues it for the authenticator
+func (s *Store) Update(record Record) {
+	s.Lock()
+	defer s.Unlock()
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	switch record.Status {
+	case AccountingOnStatus, AccountingOffStatus:
+		// The NAS restarted, its sessions are over
+		for _, session := range s.sessions {
+			if session.Active() && session.Nas == record.Nas {
+				stopped := record.Time
+				session.Stopped = &stopped
+				session.TerminateCause = "NAS-Reboot"
+			}
+		}
+	default:
+		key := getSessionKey(record.ID, record.Nas, record.Mac)
+		session, found := s.sessions[key]
+		if !found {
+			if len(s.sessions) >= s.config.MaxSessions {
+				s.evictOldest()
+			}
+			session = &Session{
+				ID:      record.ID,
+				Nas:     record.Nas,
+				Mac:     record.Mac,
+				Started: record.Time.Add(-time.Duration(record.Duration) * time.Second),
+			}
+			s.sessions[key] = session
+		}
+		session.Username = record.Username
+		session.Updated = record.Time
+		if len(record.Source) > 0 {
+			session.Source = record.Source
+		}
+		if len(record.NasPort) > 0 {
+			session.NasPort = record.NasPort
+		}
+		if len(record.FramedIP) > 0 {
+			session.FramedIP = record.FramedIP
+		}
+		if record.VLAN > 0 {
+			session.VLAN = record.VLAN
+		}
+		if record.InputBytes > session.InputBytes {
+			session.InputBytes = record.InputBytes
+		}
+		if record.OutputBytes > session.OutputBytes {
+			session.OutputBytes = record.OutputBytes
+		}
+		if record.Duration > session.Duration {
+			session.Duration = record.Duration
+		}
+		if record.Status == StopStatus {
+			stopped := record.Time
+			session.Stopped = &stopped
+			session.TerminateCause = record.TerminateCause
+		}
+		record.Session = *session
+	}
+	if s.config.Forward {
+		s.pending = append(s.pending, record)
+		if overflow := len(s.pending) - s.config.BufferSize; overflow > 0 {
+			s.pending = s.pending[overflow:]
+			s.dropped += overflow
+			s.log.Warnf("Accounting buffer full, %d records dropped", overflow)
+		}
+	}
+}
+
+// older reports if session a goes before b when the table is full: stopped sessions first, then the least recently updated
+func older(a *Session, b *Session) bool {
+	if a.Active() != b.Active() {
+		return !a.Active()
+	}
+	return a.Updated.Before(b.Updated)
+}
+
+// evictOldest removes the session going first when the table is full
+func (s *Store) evictOldest() {
+	var oldestKey string
+	var oldest *Session
+	for key, session := range s.sessions {
+		if oldest == nil || older(session, oldest) {
+			oldestKey, oldest = key, session
+		}
+	}
+	if oldest != nil {
+		delete(s.sessions, oldestKey)
+	}
+}
+
+// prune removes the sessions stopped before the retention and the oldest ones beyond the table size
+func (s *Store) prune() {
+	for key, session := range s.sessions {
+		if !session.Active() && time.Since(*session.Stopped) > s.config.Retention {
+			delete(s.sessions, key)
+		}
+	}
+	overflow := len(s.sessions) - s.config.MaxSessions
+	if overflow <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.sessions))
+	for key := range s.sessions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return older(s.sessions[keys[i]], s.sessions[keys[j]])
+	})
+	for _, key := range keys[:overflow] {
+		delete(s.sessions, key)
+	}
+}
+
+// Filter selects sessions, empty fields match every session
+type Filter struct {
+	Username string
+	// Canonical MAC address
+	Mac  string
+	Nas  string
+	VLAN uint16
+	// Only active (true) or stopped (false) sessions
+	Active *bool
+}
+
+// Match reports if the session is selected by the filter
+func (f Filter) Match(session Session) bool {
+	if len(f.Username) > 0 && !strings.EqualFold(f.Username, session.Username) {
+		return false
+	}
+	if len(f.Mac) > 0 && f.Mac != session.Mac {
+		return false
+	}
+	if len(f.Nas) > 0 && f.Nas != session.Nas {
+		return false
+	}
+	if f.VLAN > 0 && f.VLAN != session.VLAN {
+		return false
+	}
+	if f.Active != nil && *f.Active != session.Active() {
+		return false
+	}
+	return true
+}
+
+// List returns a copy of the sessions selected by the filter, the most recently updated first
+func (s *Store) List(filter Filter) []Session {
+	s.Lock()
+	defer s.Unlock()
+	sessions := make([]Session, 0)
+	for _, session := range s.sessions {
+		if filter.Match(*session) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions
+}
+
+// Page returns at most limit sessions, starting at offset
+func Page(sessions []Session, offset int, limit int) []Session {
+	if offset < 0 || limit <= 0 || offset >= len(sessions) {
+		return []Session{}
+	}
+	end := offset + limit
+	if end > len(sessions) || end < offset {
+		end = len(sessions)
+	}
+	return sessions[offset:end]
+}
+
+// Get returns the most recently updated session with this Acct-Session-Id
+func (s *Store) Get(id string) (Session, bool) {
+	s.Lock()
+	defer s.Unlock()
+	var found *Session
+	for _, session := range s.sessions {
+		if session.ID == id && (found == nil || session.Updated.After(found.Updated)) {
+			found = session
+		}
+	}
+	if found == nil {
+		return Session{}, false
+	}
+	return *found, true
+}
+
+func (s *Store) Status() Status {
+	s.Lock()
+	defer s.Unlock()
+	status := Status{Total: len(s.sessions), Pending: len(s.pending), Dropped: s.dropped}
+	for _, session := range s.sessions {
+		if session.Active() {
+			status.Active++
+		}
+	}
+	return status
+}
+
+// flush sends the pending records by batches until the buffer is empty, the authenticator fails or ctx ends
+func (s *Store) flush(ctx context.Context) {
+	if s.forwarder == nil {
+		return
+	}
+	for {
+		s.Lock()
+		if len(s.pending) == 0 {
+			s.Unlock()
+			return
+		}
+		size := s.config.BatchSize
+		if size > len(s.pending) {
+			size = len(s.pending)
+		}
+		batch := append([]Record{}, s.pending[:size]...)
+		dropped := s.dropped
+		s.Unlock()
+		if err := s.forwarder(ctx, batch); err != nil {
+			s.log.Debugf("Cannot forward %d accounting records, keeping them: %s", len(batch), err)
+			return
+		}
+		s.Lock()
+		// Some of the sent records may have been dropped from the buffer while sending
+		sent := size - (s.dropped - dropped)
+		if sent > 0 {
+			s.pending = s.pending[sent:]
+		}
+		s.Unlock()
+		s.log.Tracef("%d accounting records forwarded", len(batch))
+	}
+}
+
+// Start prunes the session table, forwards the accounting records and writes the session snapshot, if configured
+func (s *Store) Start() error {
+	if s.done != nil {
+		return nil
+	}
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go func(done chan struct{}) {
+		defer s.wg.Done()
+		flushTick := time.NewTicker(s.config.FlushInterval)
+		defer flushTick.Stop()
+		saveTick := time.NewTicker(s.config.SaveInterval)
+		defer saveTick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-flushTick.C:
+				// Pruning on each accounting record would scan the whole table
+				s.Lock()
+				s.prune()
+				s.Unlock()
+				if s.config.Forward {
+					s.flush(context.Background())
+				}
+			case <-saveTick.C:
+				if len(s.config.Path) > 0 {
+					if err := s.save(); err != nil {
+						s.log.Errorf("Cannot write session snapshot %s: %s", s.config.Path, err)
+					}
+				}
+			}
+		}
+	}(s.done)
+	return nil
+}
+
+// Stop forwards the pending records, for a bounded time, and writes a last session snapshot with the remaining ones, if configured
+func (s *Store) Stop() error {
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.done = nil
+	}
+	if s.config.Forward {
+		ctx, cancel := context.WithTimeout(context.Background(), stopFlushTimeout)
+		s.flush(ctx)
+		cancel()
+		if pending := s.Status().Pending; pending > 0 && len(s.config.Path) == 0 {
+			s.log.Warnf("%d accounting records not forwarded are lost", pending)
+		}
+	}
+	if len(s.config.Path) == 0 {
+		return nil
+	}
+	return s.save()
+}
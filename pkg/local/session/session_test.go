@@ -0,0 +1,189 @@
+package session
+
+import (
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	stopped := time.Now()
+	active := Session{ID: "1", Username: "Alice", Mac: "aa:bb:cc:dd:ee:ff", Nas: "192.0.2.1", VLAN: 10}
+	ended := Session{ID: "2", Username: "bob", Mac: "aa:bb:cc:dd:ee:00", Nas: "192.0.2.2", VLAN: 20, Stopped: &stopped}
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []bool
+	}{
+		{name: "empty", filter: Filter{}, want: []bool{true, true}},
+		{name: "username ignores case", filter: Filter{Username: "alice"}, want: []bool{true, false}},
+		{name: "mac", filter: Filter{Mac: "aa:bb:cc:dd:ee:00"}, want: []bool{false, true}},
+		{name: "nas", filter: Filter{Nas: "192.0.2.1"}, want: []bool{true, false}},
+		{name: "vlan", filter: Filter{VLAN: 20}, want: []bool{false, true}},
+		{name: "active", filter: Filter{Active: &yes}, want: []bool{true, false}},
+		{name: "stopped", filter: Filter{Active: &no}, want: []bool{false, true}},
+		{name: "every field", filter: Filter{Username: "BOB", Mac: "aa:bb:cc:dd:ee:00", Nas: "192.0.2.2", VLAN: 20, Active: &no}, want: []bool{false, true}},
+		{name: "one field differs", filter: Filter{Username: "bob", VLAN: 10}, want: []bool{false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, session := range []Session{active, ended} {
+				if got := test.filter.Match(session); got != test.want[i] {
+					t.Errorf("session %s: got %v, want %v", session.ID, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	sessions := make([]Session, 5)
+	for i := range sessions {
+		sessions[i].ID = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   []string
+	}{
+		{name: "first page", offset: 0, limit: 2, want: []string{"0", "1"}},
+		{name: "middle page", offset: 2, limit: 2, want: []string{"2", "3"}},
+		{name: "last partial page", offset: 4, limit: 2, want: []string{"4"}},
+		{name: "limit beyond the end", offset: 0, limit: 100, want: []string{"0", "1", "2", "3", "4"}},
+		{name: "offset at the end", offset: 5, limit: 2, want: []string{}},
+		{name: "offset beyond the end", offset: 10, limit: 2, want: []string{}},
+		{name: "negative offset", offset: -1, limit: 2, want: []string{}},
+		{name: "zero limit", offset: 0, limit: 0, want: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := Page(sessions, test.offset, test.limit)
+			if page == nil {
+				t.Fatal("page must not be nil")
+			}
+			if len(page) != len(test.want) {
+				t.Fatalf("got %d sessions, want %d", len(page), len(test.want))
+			}
+			for i := range page {
+				if page[i].ID != test.want[i] {
+					t.Errorf("session %d: got %s, want %s", i, page[i].ID, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	config := &Configuration{}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := New(log.NewEntry(log.New()), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, username := range []string{"alice", "bob", "alice"} {
+		store.Update(Record{Status: StartStatus, Time: now.Add(time.Duration(i) * time.Second), Session: Session{
+			ID:       strconv.Itoa(i),
+			Username: username,
+			Mac:      "aa:bb:cc:dd:ee:ff",
+			Nas:      "192.0.2.1",
+		}})
+	}
+	sessions := store.List(Filter{Username: "alice"})
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	// The most recently updated first
+	if sessions[0].ID != "2" || sessions[1].ID != "0" {
+		t.Fatalf("got sessions %s and %s, want 2 and 0", sessions[0].ID, sessions[1].ID)
+	}
+}
+
+func TestEvictOldest(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		records []Record
+		want    []string
+	}{
+		{
+			name: "least recently updated",
+			records: []Record{
+				{Status: StartStatus, Time: now, Session: Session{ID: "1"}},
+				{Status: StartStatus, Time: now.Add(time.Second), Session: Session{ID: "2"}},
+				{Status: InterimStatus, Time: now.Add(2 * time.Second), Session: Session{ID: "1"}},
+				{Status: StartStatus, Time: now.Add(3 * time.Second), Session: Session{ID: "3"}},
+			},
+			want: []string{"3", "1"},
+		},
+		{
+			name: "stopped first",
+			records: []Record{
+				{Status: StartStatus, Time: now, Session: Session{ID: "1"}},
+				{Status: StopStatus, Time: now.Add(time.Second), Session: Session{ID: "2"}},
+				{Status: StartStatus, Time: now.Add(2 * time.Second), Session: Session{ID: "3"}},
+			},
+			want: []string{"3", "1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Configuration{MaxSessions: 2}
+			if err := config.Check(); err != nil {
+				t.Fatal(err)
+			}
+			store, err := New(log.NewEntry(log.New()), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range test.records {
+				record.Nas = "192.0.2.1"
+				store.Update(record)
+			}
+			sessions := store.List(Filter{})
+			if len(sessions) != len(test.want) {
+				t.Fatalf("got %d sessions, want %d", len(sessions), len(test.want))
+			}
+			for i := range sessions {
+				if sessions[i].ID != test.want[i] {
+					t.Errorf("session %d: got %s, want %s", i, sessions[i].ID, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	config := &Configuration{Retention: time.Hour}
+	if err := config.Check(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := New(log.NewEntry(log.New()), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.Update(Record{Status: StopStatus, Time: now.Add(-2 * time.Hour), Session: Session{ID: "expired", Nas: "192.0.2.1"}})
+	store.Update(Record{Status: StopStatus, Time: now, Session: Session{ID: "stopped", Nas: "192.0.2.1"}})
+	store.Update(Record{Status: StartStatus, Time: now.Add(-2 * time.Hour), Session: Session{ID: "active", Nas: "192.0.2.1"}})
+	// Accounting records do not prune the table
+	if total := store.Status().Total; total != 3 {
+		t.Fatalf("got %d sessions before pruning, want 3", total)
+	}
+	store.Lock()
+	store.prune()
+	store.Unlock()
+	if _, found := store.Get("expired"); found {
+		t.Fatal("session stopped before the retention not pruned")
+	}
+	for _, id := range []string{"stopped", "active"} {
+		if _, found := store.Get(id); !found {
+			t.Fatalf("session %s pruned", id)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package token
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TimestampHeader = "X-Rip-Timestamp"
+	NonceHeader     = "X-Rip-Nonce"
+	SignatureHeader = "X-Rip-Signature"
+)
+
+var MissingSignatureError = errors.New("missing request signature")
+var InvalidSignatureError = errors.New("invalid request signature")
+var ExpiredSignatureError = errors.New("request signature outside of the replay window")
+var ReplayedSignatureError = errors.New("request signature already used")
+
+// SigningKey derives the request signing key from the RADIUS secret
+func SigningKey(radiusSecret string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(radiusSecret), nil, []byte("ripradius request signing")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of a request.
+// uri is the request path with its query string.
+func Sign(key []byte, method string, uri string, body []byte, timestamp int64, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s", strings.ToUpper(method), uri, hex.EncodeToString(bodyHash[:]), timestamp, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody returns the request body, leaving it readable
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// SignRequest adds the signature headers to an outgoing request
+func SignRequest(key []byte, r *http.Request, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(random)
+	timestamp := now.Unix()
+	r.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, Sign(key, r.Method, r.URL.RequestURI(), body, timestamp, nonce))
+	return nil
+}
+
+// Verifier checks signed requests, refusing the ones outside the replay window or already seen
+type Verifier struct {
+	key    []byte
+	window time.Duration
+	// nonces seen in the replay window, with their timestamp
+	nonces map[string]time.Time
+	sync.Mutex
+}
+
+// NewVerifier returns a verifier for requests signed with the key derived from radiusSecret.
+// Requests are accepted if their timestamp is less than window away from the local clock.
+func NewVerifier(radiusSecret string, window time.Duration) (*Verifier, error) {
+	key, err := SigningKey(radiusSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{key: key, window: window, nonces: make(map[string]time.Time)}, nil
+}
+
+// Verify checks the signature of an incoming request, leaving its body readable
+func (v *Verifier) Verify(r *http.Request) error {
+	return v.verify(r, time.Now())
+}
+
+func (v *Verifier) verify(r *http.Request, now time.Time) error {
+	signature := r.Header.Get(SignatureHeader)
+	nonce := r.Header.Get(NonceHeader)
+	if len(signature) == 0 || len(nonce) == 0 || len(r.Header.Get(TimestampHeader)) == 0 {
+		return MissingSignatureError
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return InvalidSignatureError
+	}
+	signed := time.Unix(timestamp, 0)
+	if signed.Before(now.Add(-v.window)) || signed.After(now.Add(v.window)) {
+		return ExpiredSignatureError
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	expected := Sign(v.key, r.Method, r.URL.RequestURI(), body, timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return InvalidSignatureError
+	}
+	v.Lock()
+	defer v.Unlock()
+	for seen, at := range v.nonces {
+		if now.Sub(at) > 2*v.window {
+			delete(v.nonces, seen)
+		}
+	}
+	if _, found := v.nonces[nonce]; found {
+		return ReplayedSignatureError
+	}
+	v.nonces[nonce] = signed
+	return nil
+}
@@ -0,0 +1,210 @@
+package token
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "radius secret"
+
+func signedRequest(t *testing.T, secret string, method string, target string, body string, signedAt time.Time) *http.Request {
+	t.Helper()
+	key, err := SigningKey(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if err := SignRequest(key, r, signedAt); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	window := 30 * time.Second
+	tests := []struct {
+		name    string
+		request func(t *testing.T) *http.Request
+		wantErr error
+	}{
+		{
+			name: "valid",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, testSecret, http.MethodPost, "/api/v1/user?realm=rip", `{"username":"alice"}`, now)
+			},
+		},
+		{
+			name: "skew inside the window",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now.Add(-window+time.Second))
+			},
+		},
+		{
+			name: "missing signature",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now)
+				r.Header.Del(SignatureHeader)
+				return r
+			},
+			wantErr: MissingSignatureError,
+		},
+		{
+			name: "invalid timestamp",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now)
+				r.Header.Set(TimestampHeader, "yesterday")
+				return r
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "wrong secret",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, "other secret", http.MethodGet, "/api/v1/status", "", now)
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "modified body",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodPost, "/api/v1/user", `{"username":"alice"}`, now)
+				r.Body = io.NopCloser(strings.NewReader(`{"username":"mallory"}`))
+				return r
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "modified query",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodGet, "/api/v1/user?realm=rip", "", now)
+				r.URL.RawQuery = "realm=admin"
+				return r
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "modified method",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodGet, "/api/v1/user", "", now)
+				r.Method = http.MethodDelete
+				return r
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "modified timestamp",
+			request: func(t *testing.T) *http.Request {
+				r := signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now)
+				r.Header.Set(TimestampHeader, "1700000001")
+				return r
+			},
+			wantErr: InvalidSignatureError,
+		},
+		{
+			name: "signed too long ago",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now.Add(-window-time.Second))
+			},
+			wantErr: ExpiredSignatureError,
+		},
+		{
+			name: "signed in the future",
+			request: func(t *testing.T) *http.Request {
+				return signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now.Add(window+time.Second))
+			},
+			wantErr: ExpiredSignatureError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier, err := NewVerifier(testSecret, window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifier.verify(test.request(t), now); !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyKeepsBody(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier, err := NewVerifier(testSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := signedRequest(t, testSecret, http.MethodPost, "/api/v1/user", `{"username":"alice"}`, now)
+	if err := verifier.verify(r, now); err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"username":"alice"}` {
+		t.Fatalf("body not readable after verification: %q", body)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	window := 30 * time.Second
+	verifier, err := NewVerifier(testSecret, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := signedRequest(t, testSecret, http.MethodPost, "/api/v1/user", `{"username":"alice"}`, now)
+	replayed := first.Clone(first.Context())
+	if err := verifier.verify(first, now); err != nil {
+		t.Fatal(err)
+	}
+	replayed.Body = io.NopCloser(strings.NewReader(`{"username":"alice"}`))
+	if err := verifier.verify(replayed, now.Add(time.Second)); !errors.Is(err, ReplayedSignatureError) {
+		t.Fatalf("got error %v, want %v", err, ReplayedSignatureError)
+	}
+	// A new nonce is accepted
+	second := signedRequest(t, testSecret, http.MethodPost, "/api/v1/user", `{"username":"alice"}`, now)
+	if err := verifier.verify(second, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyNonceExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	window := 30 * time.Second
+	verifier, err := NewVerifier(testSecret, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := verifier.verify(signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", now), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(verifier.nonces) != 3 {
+		t.Fatalf("got %d nonces, want 3", len(verifier.nonces))
+	}
+	// Nonces are kept while a replay could still be inside the window
+	later := now.Add(2 * window)
+	if err := verifier.verify(signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", later), later); err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier.nonces) != 4 {
+		t.Fatalf("got %d nonces, want 4", len(verifier.nonces))
+	}
+	// Past twice the window, they cannot be replayed anymore and are forgotten
+	expired := now.Add(2*window + time.Second)
+	if err := verifier.verify(signedRequest(t, testSecret, http.MethodGet, "/api/v1/status", "", expired), expired); err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier.nonces) != 2 {
+		t.Fatalf("got %d nonces, want 2", len(verifier.nonces))
+	}
+}
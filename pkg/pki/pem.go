@@ -0,0 +1,159 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/COSAE-FR/riputils/common"
+	"os"
+	"strings"
+)
+
+// IsPEM reports if value is inline PEM content rather than a file path
+func IsPEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN ")
+}
+
+// Load returns the PEM content of value, read from the file it names if it is not inline PEM
+func Load(name string, value string) (string, error) {
+	if IsPEM(value) {
+		return value, nil
+	}
+	if !common.FileExists(value) {
+		return "", fmt.Errorf("%s is not a PEM string nor a valid file", name)
+	}
+	content, err := os.ReadFile(value)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s file: %w", name, err)
+	}
+	if !IsPEM(string(content)) {
+		return "", fmt.Errorf("%s file %s does not contain PEM data", name, value)
+	}
+	return string(content), nil
+}
+
+// ParseCertificates returns every certificate of a PEM bundle
+func ParseCertificates(name string, content string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", name, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", name)
+	}
+	return certificates, nil
+}
+
+// LoadCertificates returns the PEM content of a certificate bundle, checking it can be parsed
+func LoadCertificates(name string, value string) (string, error) {
+	content, err := Load(name, value)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ParseCertificates(name, content); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+// LoadKey returns the unencrypted PEM content of a RSA, EC, Ed25519 or PKCS#8 private key.
+// Encrypted PKCS#8 and legacy encrypted PEM keys are decrypted with the content of passphraseFile.
+func LoadKey(value string, passphraseFile string) (string, error) {
+	content, err := Load("key", value)
+	if err != nil {
+		return "", err
+	}
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return "", errors.New("no private key found in key PEM")
+		}
+		switch block.Type {
+		case "ENCRYPTED PRIVATE KEY":
+			passphrase, err := readPassphrase(passphraseFile)
+			if err != nil {
+				return "", err
+			}
+			der, err := decryptPKCS8(block.Bytes, passphrase)
+			if errors.Is(err, UnsupportedEncryptionError) {
+				return "", err
+			}
+			if err != nil {
+				return "", fmt.Errorf("cannot decrypt key, wrong passphrase: %w", err)
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+			// Legacy PEM encryption
+			if x509.IsEncryptedPEMBlock(block) {
+				passphrase, err := readPassphrase(passphraseFile)
+				if err != nil {
+					return "", err
+				}
+				der, err := x509.DecryptPEMBlock(block, passphrase)
+				if err != nil {
+					return "", fmt.Errorf("cannot decrypt key, wrong passphrase: %w", err)
+				}
+				block = &pem.Block{Type: block.Type, Bytes: der}
+			}
+		default:
+			continue
+		}
+		if err := checkKey(block); err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(block)), nil
+	}
+}
+
+// readPassphrase returns the passphrase of an encrypted key, stored in passphraseFile
+func readPassphrase(passphraseFile string) ([]byte, error) {
+	if len(passphraseFile) == 0 {
+		return nil, errors.New("key is encrypted, a passphrase file is needed")
+	}
+	passphrase, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key passphrase file: %w", err)
+	}
+	return []byte(strings.TrimRight(string(passphrase), "\r\n")), nil
+}
+
+func checkKey(block *pem.Block) error {
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", strings.ToLower(block.Type), err)
+	}
+	return nil
+}
+
+// CheckKeyPair checks the private key matches the first certificate of the bundle
+func CheckKeyPair(certificate string, key string) error {
+	if _, err := tls.X509KeyPair([]byte(certificate), []byte(key)); err != nil {
+		return fmt.Errorf("private key does not match certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+)
+
+var UnsupportedEncryptionError = errors.New("unsupported key encryption, only PBES2 with PBKDF2 and AES or 3DES is supported")
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+)
+
+// prfs are the PBKDF2 pseudorandom functions
+var prfs = map[string]func() hash.Hash{
+	"1.2.840.113549.2.7":  sha1.New,
+	"1.2.840.113549.2.8":  sha256.New224,
+	"1.2.840.113549.2.9":  sha256.New,
+	"1.2.840.113549.2.10": sha512.New384,
+	"1.2.840.113549.2.11": sha512.New,
+}
+
+type pbes2Cipher struct {
+	keyLength int
+	block     func(key []byte) (cipher.Block, error)
+}
+
+// pbes2Ciphers are the PBES2 encryption schemes, all in CBC mode
+var pbes2Ciphers = map[string]pbes2Cipher{
+	"2.16.840.1.101.3.4.1.2":  {keyLength: 16, block: aes.NewCipher},
+	"2.16.840.1.101.3.4.1.22": {keyLength: 24, block: aes.NewCipher},
+	"2.16.840.1.101.3.4.1.42": {keyLength: 32, block: aes.NewCipher},
+	"1.2.840.113549.3.7":      {keyLength: 24, block: des.NewTripleDESCipher},
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Parameters struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Parameters struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                 `asn1:"optional"`
+	PRF            algorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 returns the DER PKCS#8 private key of an encrypted PKCS#8 key
+func decryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted private key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, UnsupportedEncryptionError
+	}
+	var parameters pbes2Parameters
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &parameters); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted private key: %w", err)
+	}
+	if !parameters.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, UnsupportedEncryptionError
+	}
+	var kdf pbkdf2Parameters
+	if _, err := asn1.Unmarshal(parameters.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted private key: %w", err)
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = prfs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, UnsupportedEncryptionError
+		}
+	}
+	scheme, ok := pbes2Ciphers[parameters.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, UnsupportedEncryptionError
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(parameters.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted private key: %w", err)
+	}
+	block, err := scheme.block(pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, scheme.keyLength, prf))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+	// A wrong passphrase shows as a bad padding
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("bad padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,104 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// CertificateInfo describes a leaf certificate and the weaknesses found during validation
+type CertificateInfo struct {
+	Subject   string
+	Issuer    string
+	NotBefore time.Time
+	NotAfter  time.Time
+	Warnings  []string
+}
+
+// DescribeCertificate returns the description of the first certificate of a bundle
+func DescribeCertificate(bundle string) (*CertificateInfo, error) {
+	certificates, err := ParseCertificates("certificate", bundle)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certificates[0]
+	info := &CertificateInfo{
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+	}
+	switch key := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("weak RSA key of %d bits", key.N.BitLen()))
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize < 256 {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("weak EC key of %d bits", key.Curve.Params().BitSize))
+		}
+	}
+	switch leaf.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+		info.Warnings = append(info.Warnings, fmt.Sprintf("weak signature algorithm %s", leaf.SignatureAlgorithm))
+	}
+	return info, nil
+}
+
+// ValidateServerCertificate checks the first certificate of a bundle can be used by a TLS server:
+// validity window, serverAuth extended key usage and, when ca is not empty, chain up to ca.
+// The other certificates of the bundle are used as intermediates.
+func ValidateServerCertificate(bundle string, ca string, now time.Time) (*CertificateInfo, error) {
+	info, err := DescribeCertificate(bundle)
+	if err != nil {
+		return nil, err
+	}
+	certificates, err := ParseCertificates("certificate", bundle)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certificates[0]
+	if now.Before(leaf.NotBefore) {
+		return info, fmt.Errorf("certificate %s is not valid before %s", info.Subject, leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return info, fmt.Errorf("certificate %s expired on %s", info.Subject, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if len(leaf.ExtKeyUsage) > 0 {
+		serverAuth := false
+		for _, usage := range leaf.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageServerAuth || usage == x509.ExtKeyUsageAny {
+				serverAuth = true
+			}
+		}
+		if !serverAuth {
+			return info, fmt.Errorf("certificate %s cannot be used for TLS servers (no serverAuth extended key usage)", info.Subject)
+		}
+	}
+	if len(ca) == 0 {
+		return info, nil
+	}
+	authorities, err := ParseCertificates("ca", ca)
+	if err != nil {
+		return info, err
+	}
+	roots := x509.NewCertPool()
+	for _, authority := range authorities {
+		roots.AddCert(authority)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range certificates[1:] {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return info, fmt.Errorf("certificate %s is not signed by the configured CA: %w", info.Subject, err)
+	}
+	return info, nil
+}
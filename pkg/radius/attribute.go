@@ -0,0 +1,117 @@
+package radius
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Attribute value types, as named in Freeradius dictionaries
+const (
+	StringType  = "string"
+	IntegerType = "integer"
+	IPAddrType  = "ipaddr"
+	OctetsType  = "octets"
+)
+
+// DefaultAllowedAttributes are the reply attributes an authenticator can always set, with their type
+var DefaultAllowedAttributes = map[string]string{
+	"Session-Timeout":       IntegerType,
+	"Idle-Timeout":          IntegerType,
+	"Termination-Action":    IntegerType,
+	"Acct-Interim-Interval": IntegerType,
+	"Filter-Id":             StringType,
+	"Class":                 OctetsType,
+	"Reply-Message":         StringType,
+	"Framed-IP-Address":     IPAddrType,
+	"Framed-MTU":            IntegerType,
+}
+
+// Attribute is a RADIUS reply attribute
+type Attribute struct {
+	Name  string `json:"name" yaml:"name"`
+	Type  string `json:"type" yaml:"type"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// Attributes is a list of RADIUS reply attributes, an attribute can be repeated
+type Attributes []Attribute
+
+// Validate checks the attribute is allowed and its value matches its type.
+// allowed maps the attribute names to their type.
+func (a Attribute) Validate(allowed map[string]string) error {
+	expected, ok := allowed[a.Name]
+	if !ok {
+		return fmt.Errorf("attribute %s is not allowed", a.Name)
+	}
+	if len(a.Type) > 0 && a.Type != expected {
+		return fmt.Errorf("attribute %s is of type %s, not %s", a.Name, expected, a.Type)
+	}
+	switch expected {
+	case IntegerType:
+		if _, err := strconv.ParseUint(a.Value, 10, 32); err != nil {
+			return fmt.Errorf("attribute %s: invalid integer %s", a.Name, a.Value)
+		}
+	case IPAddrType:
+		if ip := net.ParseIP(a.Value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("attribute %s: invalid IPv4 address %s", a.Name, a.Value)
+		}
+	case OctetsType:
+		if strings.HasPrefix(a.Value, "0x") {
+			if _, err := hex.DecodeString(a.Value[2:]); err != nil {
+				return fmt.Errorf("attribute %s: invalid hexadecimal value", a.Name)
+			}
+		} else if len(a.Value) > 253 {
+			return fmt.Errorf("attribute %s: value longer than 253 bytes", a.Name)
+		}
+	case StringType:
+		if len(a.Value) > 253 {
+			return fmt.Errorf("attribute %s: value longer than 253 bytes", a.Name)
+		}
+	default:
+		return fmt.Errorf("attribute %s has an unknown type %s", a.Name, expected)
+	}
+	return nil
+}
+
+// Filter returns the valid attributes and the errors of the other ones
+func (a Attributes) Filter(allowed map[string]string) (Attributes, []error) {
+	var valid Attributes
+	var errs []error
+	for _, attribute := range a {
+		if err := attribute.Validate(allowed); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		attribute.Type = allowed[attribute.Name]
+		valid = append(valid, attribute)
+	}
+	return valid, errs
+}
+
+// ReplyValue is a reply attribute in the Freeradius rest module format.
+// Values come from the authenticator, they must not be expanded as %{...} by Freeradius.
+type ReplyValue struct {
+	Value  []string `json:"value"`
+	DoXlat bool     `json:"do_xlat"`
+}
+
+// Reply returns the attributes in the Freeradius rest module format, with repeated attributes as arrays
+func (a Attributes) Reply() map[string]interface{} {
+	values := make(map[string]*ReplyValue, len(a))
+	for _, attribute := range a {
+		key := "reply:" + attribute.Name
+		if value, found := values[key]; found {
+			value.Value = append(value.Value, attribute.Value)
+			continue
+		}
+		values[key] = &ReplyValue{Value: []string{attribute.Value}}
+	}
+	reply := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		reply[key] = *value
+	}
+	return reply
+}
@@ -0,0 +1,22 @@
+package radius
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAttributesReply(t *testing.T) {
+	attributes := Attributes{
+		{Name: "Reply-Message", Value: "100% %{User-Password}"},
+		{Name: "Class", Value: "staff"},
+		{Name: "Class", Value: "wifi"},
+	}
+	content, err := json.Marshal(attributes.Reply())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"reply:Class":{"value":["staff","wifi"],"do_xlat":false},"reply:Reply-Message":{"value":["100% %{User-Password}"],"do_xlat":false}}`
+	if string(content) != expected {
+		t.Fatalf("got %s, want %s", content, expected)
+	}
+}
@@ -0,0 +1,269 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Dynamic authorization (RFC 5176) packet codes
+const (
+	DisconnectRequest = 40
+	DisconnectACK     = 41
+	DisconnectNAK     = 42
+	CoARequest        = 43
+	CoAACK            = 44
+	CoANAK            = 45
+)
+
+const (
+	headerLength              = 20
+	maxPacketLength           = 4096
+	messageAuthenticatorType  = 80
+	errorCauseType            = 101
+	vendorSpecificType        = 26
+	messageAuthenticatorValue = 16
+)
+
+var InvalidResponseError = errors.New("invalid dynamic authorization response")
+
+type dictionaryEntry struct {
+	vendor uint32
+	code   byte
+	kind   string
+	tagged bool
+	values map[string]uint32
+}
+
+// dictionary holds the attributes that can be sent in dynamic authorization requests
+var dictionary = map[string]dictionaryEntry{
+	"User-Name":               {code: 1, kind: StringType},
+	"NAS-IP-Address":          {code: 4, kind: IPAddrType},
+	"NAS-Port":                {code: 5, kind: IntegerType},
+	"Framed-IP-Address":       {code: 8, kind: IPAddrType},
+	"Filter-Id":               {code: 11, kind: StringType},
+	"Framed-MTU":              {code: 12, kind: IntegerType},
+	"Reply-Message":           {code: 18, kind: StringType},
+	"Class":                   {code: 25, kind: OctetsType},
+	"Session-Timeout":         {code: 27, kind: IntegerType},
+	"Idle-Timeout":            {code: 28, kind: IntegerType},
+	"Termination-Action":      {code: 29, kind: IntegerType},
+	"Calling-Station-Id":      {code: 31, kind: StringType},
+	"Acct-Session-Id":         {code: 44, kind: StringType},
+	"Tunnel-Type":             {code: 64, kind: IntegerType, tagged: true, values: map[string]uint32{"VLAN": 13}},
+	"Tunnel-Medium-Type":      {code: 65, kind: IntegerType, tagged: true, values: map[string]uint32{"IEEE-802": 6}},
+	"Tunnel-Private-Group-Id": {code: 81, kind: StringType},
+	"Acct-Interim-Interval":   {code: 85, kind: IntegerType},
+	"Aruba-User-Role":         {vendor: 14823, code: 1, kind: StringType},
+	"Cisco-AVPair":            {vendor: 9, code: 1, kind: StringType},
+}
+
+// errorCauses are the RFC 5176 Error-Cause values
+var errorCauses = map[uint32]string{
+	201: "Residual Session Context Removed",
+	202: "Invalid EAP Packet (Ignored)",
+	401: "Unsupported Attribute",
+	402: "Missing Attribute",
+	403: "NAS Identification Mismatch",
+	404: "Invalid Request",
+	405: "Unsupported Service",
+	406: "Unsupported Extension",
+	407: "Invalid Attribute Value",
+	501: "Administratively Prohibited",
+	502: "Request Not Routable (Proxy)",
+	503: "Session Context Not Found",
+	504: "Session Context Not Removable",
+	505: "Other Proxy Processing Error",
+	506: "Resources Unavailable",
+	507: "Request Initiated",
+	508: "Multiple Session Selection Unsupported",
+}
+
+// ErrorCause returns the description of an Error-Cause value
+func ErrorCause(cause uint32) string {
+	if description, ok := errorCauses[cause]; ok {
+		return description
+	}
+	return fmt.Sprintf("Error-Cause %d", cause)
+}
+
+// DynamicRequest is a CoA-Request or a Disconnect-Request
+type DynamicRequest struct {
+	Code       byte
+	Identifier byte
+	Attributes Attributes
+}
+
+// DynamicResponse is the answer of a NAS to a dynamic authorization request
+type DynamicResponse struct {
+	Code       byte
+	Identifier byte
+	// Error-Cause of a NAK, 0 when absent
+	ErrorCause uint32
+}
+
+// Acknowledged reports if the NAS applied the request
+func (r DynamicResponse) Acknowledged() bool {
+	return r.Code == DisconnectACK || r.Code == CoAACK
+}
+
+func (a Attribute) encode() ([]byte, error) {
+	entry, ok := dictionary[a.Name]
+	if !ok {
+		return nil, fmt.Errorf("attribute %s cannot be sent in dynamic authorization requests", a.Name)
+	}
+	var value []byte
+	switch entry.kind {
+	case IntegerType:
+		number, ok := entry.values[a.Value]
+		if !ok {
+			parsed, err := strconv.ParseUint(a.Value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s: invalid integer %s", a.Name, a.Value)
+			}
+			number = uint32(parsed)
+		}
+		value = binary.BigEndian.AppendUint32(nil, number)
+		if entry.tagged {
+			// The tag replaces the first octet, 0 for untagged tunnels
+			value[0] = 0
+		}
+	case IPAddrType:
+		ip := net.ParseIP(a.Value).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("attribute %s: invalid IPv4 address %s", a.Name, a.Value)
+		}
+		value = ip
+	case OctetsType:
+		if len(a.Value) > 2 && a.Value[:2] == "0x" {
+			decoded, err := hex.DecodeString(a.Value[2:])
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s: invalid hexadecimal value", a.Name)
+			}
+			value = decoded
+		} else {
+			value = []byte(a.Value)
+		}
+	default:
+		value = []byte(a.Value)
+	}
+	if entry.vendor > 0 {
+		if len(value) > 247 {
+			return nil, fmt.Errorf("attribute %s: value too long", a.Name)
+		}
+		vsa := binary.BigEndian.AppendUint32(nil, entry.vendor)
+		vsa = append(vsa, entry.code, byte(len(value)+2))
+		value = append(vsa, value...)
+		return append([]byte{vendorSpecificType, byte(len(value) + 2)}, value...), nil
+	}
+	if len(value) == 0 || len(value) > 253 {
+		return nil, fmt.Errorf("attribute %s: invalid value length %d", a.Name, len(value))
+	}
+	return append([]byte{entry.code, byte(len(value) + 2)}, value...), nil
+}
+
+// Encode returns the request packet, with its Message-Authenticator and Request Authenticator
+func (r *DynamicRequest) Encode(secret string) ([]byte, error) {
+	if r.Code != DisconnectRequest && r.Code != CoARequest {
+		return nil, fmt.Errorf("code %d is not a dynamic authorization request", r.Code)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty RADIUS secret")
+	}
+	packet := make([]byte, headerLength, maxPacketLength)
+	packet[0] = r.Code
+	packet[1] = r.Identifier
+	for _, attribute := range r.Attributes {
+		encoded, err := attribute.encode()
+		if err != nil {
+			return nil, err
+		}
+		packet = append(packet, encoded...)
+	}
+	// Message-Authenticator is computed with zeroed authenticators (RFC 5176 section 3.3)
+	packet = append(packet, messageAuthenticatorType, messageAuthenticatorValue+2)
+	offset := len(packet)
+	packet = append(packet, make([]byte, messageAuthenticatorValue)...)
+	if len(packet) > maxPacketLength {
+		return nil, errors.New("dynamic authorization request too long")
+	}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(packet)
+	copy(packet[offset:], mac.Sum(nil))
+	// The Request Authenticator is computed as for Accounting-Request
+	hash := md5.New()
+	hash.Write(packet)
+	hash.Write([]byte(secret))
+	copy(packet[4:headerLength], hash.Sum(nil))
+	return packet, nil
+}
+
+// DecodeDynamicResponse checks a NAS answer against the request packet and returns it
+func DecodeDynamicResponse(packet []byte, request []byte, secret string) (DynamicResponse, error) {
+	response := DynamicResponse{}
+	if len(packet) < headerLength || len(request) < headerLength {
+		return response, fmt.Errorf("%w: packet too short", InvalidResponseError)
+	}
+	length := int(binary.BigEndian.Uint16(packet[2:4]))
+	if length < headerLength || length > len(packet) {
+		return response, fmt.Errorf("%w: invalid length %d", InvalidResponseError, length)
+	}
+	packet = packet[:length]
+	response.Code = packet[0]
+	response.Identifier = packet[1]
+	if response.Identifier != request[1] {
+		return response, fmt.Errorf("%w: identifier %d does not match request %d", InvalidResponseError, response.Identifier, request[1])
+	}
+	switch {
+	case request[0] == DisconnectRequest && (response.Code == DisconnectACK || response.Code == DisconnectNAK):
+	case request[0] == CoARequest && (response.Code == CoAACK || response.Code == CoANAK):
+	default:
+		return response, fmt.Errorf("%w: unexpected code %d", InvalidResponseError, response.Code)
+	}
+	// Response Authenticator = MD5(Code+Identifier+Length+Request Authenticator+Attributes+Secret)
+	hash := md5.New()
+	hash.Write(packet[:4])
+	hash.Write(request[4:headerLength])
+	hash.Write(packet[headerLength:])
+	hash.Write([]byte(secret))
+	if !hmac.Equal(hash.Sum(nil), packet[4:headerLength]) {
+		return response, fmt.Errorf("%w: bad authenticator, check the NAS secret", InvalidResponseError)
+	}
+	for attributes := packet[headerLength:]; len(attributes) > 0; {
+		if len(attributes) < 2 || attributes[1] < 2 || int(attributes[1]) > len(attributes) {
+			return response, fmt.Errorf("%w: malformed attributes", InvalidResponseError)
+		}
+		value := attributes[2:attributes[1]]
+		if attributes[0] == messageAuthenticatorType && len(value) == messageAuthenticatorValue {
+			if err := checkResponseMessageAuthenticator(packet, request, secret, len(packet)-len(attributes)+2); err != nil {
+				return response, err
+			}
+		}
+		if attributes[0] == errorCauseType && len(value) == 4 {
+			response.ErrorCause = binary.BigEndian.Uint32(value)
+		}
+		attributes = attributes[attributes[1]:]
+	}
+	return response, nil
+}
+
+// checkResponseMessageAuthenticator verifies the Message-Authenticator at offset, computed with the Request Authenticator
+func checkResponseMessageAuthenticator(packet []byte, request []byte, secret string, offset int) error {
+	signed := append([]byte{}, packet...)
+	copy(signed[4:headerLength], request[4:headerLength])
+	received := append([]byte{}, signed[offset:offset+messageAuthenticatorValue]...)
+	copy(signed[offset:offset+messageAuthenticatorValue], make([]byte, messageAuthenticatorValue))
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write(signed)
+	if !bytes.Equal(mac.Sum(nil), received) {
+		return fmt.Errorf("%w: bad Message-Authenticator", InvalidResponseError)
+	}
+	return nil
+}
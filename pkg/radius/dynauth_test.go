@@ -0,0 +1,263 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+const testSecret = "testing123"
+
+// attributeAt returns the value of the first attribute of this type, and its offset in the packet
+func attributeAt(t *testing.T, packet []byte, kind byte) ([]byte, int) {
+	t.Helper()
+	for offset := headerLength; offset < len(packet); offset += int(packet[offset+1]) {
+		if packet[offset+1] < 2 {
+			t.Fatalf("malformed attribute at %d", offset)
+		}
+		if packet[offset] == kind {
+			return packet[offset+2 : offset+int(packet[offset+1])], offset + 2
+		}
+	}
+	return nil, 0
+}
+
+// buildResponse returns a NAS answer to request, as described in RFC 5176 section 3.3
+func buildResponse(request []byte, code byte, secret string, attributes []byte, messageAuthenticator bool) []byte {
+	response := []byte{code, request[1], 0, 0}
+	response = append(response, request[4:headerLength]...)
+	response = append(response, attributes...)
+	offset := 0
+	if messageAuthenticator {
+		response = append(response, messageAuthenticatorType, messageAuthenticatorValue+2)
+		offset = len(response)
+		response = append(response, make([]byte, messageAuthenticatorValue)...)
+	}
+	binary.BigEndian.PutUint16(response[2:4], uint16(len(response)))
+	if messageAuthenticator {
+		mac := hmac.New(md5.New, []byte(secret))
+		mac.Write(response)
+		copy(response[offset:], mac.Sum(nil))
+	}
+	hash := md5.New()
+	hash.Write(response)
+	hash.Write([]byte(secret))
+	copy(response[4:headerLength], hash.Sum(nil))
+	return response
+}
+
+func errorCauseAttribute(cause uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{errorCauseType, 6}, cause)
+}
+
+func encodeRequest(t *testing.T, code byte) []byte {
+	t.Helper()
+	request := DynamicRequest{
+		Code:       code,
+		Identifier: 42,
+		Attributes: Attributes{
+			{Name: "User-Name", Value: "alice"},
+			{Name: "Calling-Station-Id", Value: "AA-BB-CC-DD-EE-FF"},
+			{Name: "NAS-IP-Address", Value: "192.0.2.1"},
+		},
+	}
+	packet, err := request.Encode(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestEncodeAuthenticators(t *testing.T) {
+	packet := encodeRequest(t, DisconnectRequest)
+	if packet[0] != DisconnectRequest || packet[1] != 42 {
+		t.Fatalf("unexpected header %v", packet[:2])
+	}
+	if length := int(binary.BigEndian.Uint16(packet[2:4])); length != len(packet) {
+		t.Fatalf("length field %d, packet length %d", length, len(packet))
+	}
+	// Request Authenticator = MD5(Code+Identifier+Length+16 zero octets+Attributes+Secret)
+	zeroed := append([]byte{}, packet...)
+	copy(zeroed[4:headerLength], make([]byte, 16))
+	hash := md5.New()
+	hash.Write(zeroed)
+	hash.Write([]byte(testSecret))
+	if !bytes.Equal(hash.Sum(nil), packet[4:headerLength]) {
+		t.Fatal("invalid Request Authenticator")
+	}
+	// Message-Authenticator = HMAC-MD5 of the packet with zeroed authenticators
+	received, offset := attributeAt(t, packet, messageAuthenticatorType)
+	if len(received) != messageAuthenticatorValue {
+		t.Fatal("missing Message-Authenticator")
+	}
+	copy(zeroed[offset:offset+messageAuthenticatorValue], make([]byte, messageAuthenticatorValue))
+	mac := hmac.New(md5.New, []byte(testSecret))
+	mac.Write(zeroed)
+	if !bytes.Equal(mac.Sum(nil), received) {
+		t.Fatal("invalid Message-Authenticator")
+	}
+	if value, _ := attributeAt(t, packet, 1); string(value) != "alice" {
+		t.Fatalf("unexpected User-Name %q", value)
+	}
+	if value, _ := attributeAt(t, packet, 4); !bytes.Equal(value, []byte{192, 0, 2, 1}) {
+		t.Fatalf("unexpected NAS-IP-Address %v", value)
+	}
+}
+
+func TestEncodeAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		attribute Attribute
+		want      []byte
+		wantErr   bool
+	}{
+		{name: "integer", attribute: Attribute{Name: "Session-Timeout", Value: "3600"}, want: []byte{27, 6, 0, 0, 0x0e, 0x10}},
+		{name: "tagged named value", attribute: Attribute{Name: "Tunnel-Type", Value: "VLAN"}, want: []byte{64, 6, 0, 0, 0, 13}},
+		{name: "string", attribute: Attribute{Name: "Tunnel-Private-Group-Id", Value: "10"}, want: []byte{81, 4, '1', '0'}},
+		{name: "hexadecimal octets", attribute: Attribute{Name: "Class", Value: "0x0102"}, want: []byte{25, 4, 1, 2}},
+		{name: "vendor specific", attribute: Attribute{Name: "Aruba-User-Role", Value: "guest"}, want: []byte{26, 13, 0, 0, 0x39, 0xe7, 1, 7, 'g', 'u', 'e', 's', 't'}},
+		{name: "unknown attribute", attribute: Attribute{Name: "Unknown-Attribute", Value: "1"}, wantErr: true},
+		{name: "invalid integer", attribute: Attribute{Name: "Session-Timeout", Value: "forever"}, wantErr: true},
+		{name: "invalid address", attribute: Attribute{Name: "Framed-IP-Address", Value: "2001:db8::1"}, wantErr: true},
+		{name: "empty string", attribute: Attribute{Name: "Filter-Id", Value: ""}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := test.attribute.encode()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", encoded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, test.want) {
+				t.Fatalf("got %v, want %v", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalidRequest(t *testing.T) {
+	if _, err := (&DynamicRequest{Code: CoAACK}).Encode(testSecret); err == nil {
+		t.Fatal("expected an error for a response code")
+	}
+	if _, err := (&DynamicRequest{Code: CoARequest}).Encode(""); err == nil {
+		t.Fatal("expected an error for an empty secret")
+	}
+}
+
+func TestDecodeDynamicResponse(t *testing.T) {
+	disconnect := encodeRequest(t, DisconnectRequest)
+	coa := encodeRequest(t, CoARequest)
+	tests := []struct {
+		name             string
+		request          []byte
+		response         func() []byte
+		wantAcknowledged bool
+		wantCause        uint32
+		wantErr          bool
+	}{
+		{
+			name:             "disconnect ACK",
+			request:          disconnect,
+			response:         func() []byte { return buildResponse(disconnect, DisconnectACK, testSecret, nil, false) },
+			wantAcknowledged: true,
+		},
+		{
+			name:             "CoA ACK with Message-Authenticator",
+			request:          coa,
+			response:         func() []byte { return buildResponse(coa, CoAACK, testSecret, nil, true) },
+			wantAcknowledged: true,
+		},
+		{
+			name:      "CoA NAK with Error-Cause",
+			request:   coa,
+			response:  func() []byte { return buildResponse(coa, CoANAK, testSecret, errorCauseAttribute(503), true) },
+			wantCause: 503,
+		},
+		{
+			name:     "disconnect NAK without Error-Cause",
+			request:  disconnect,
+			response: func() []byte { return buildResponse(disconnect, DisconnectNAK, testSecret, nil, false) },
+		},
+		{
+			name:     "bad authenticator",
+			request:  disconnect,
+			response: func() []byte { return buildResponse(disconnect, DisconnectACK, "wrong secret", nil, false) },
+			wantErr:  true,
+		},
+		{
+			name:    "bad Message-Authenticator",
+			request: coa,
+			response: func() []byte {
+				response := buildResponse(coa, CoAACK, testSecret, nil, true)
+				_, offset := attributeAt(t, response, messageAuthenticatorType)
+				response[offset] ^= 0xff
+				// Keep the Response Authenticator valid, so that only the Message-Authenticator is wrong
+				copy(response[4:headerLength], coa[4:headerLength])
+				hash := md5.New()
+				hash.Write(response)
+				hash.Write([]byte(testSecret))
+				copy(response[4:headerLength], hash.Sum(nil))
+				return response
+			},
+			wantErr: true,
+		},
+		{
+			name:    "wrong identifier",
+			request: disconnect,
+			response: func() []byte {
+				other := append([]byte{}, disconnect...)
+				other[1]++
+				return buildResponse(other, DisconnectACK, testSecret, nil, false)
+			},
+			wantErr: true,
+		},
+		{
+			name:     "code of another request",
+			request:  disconnect,
+			response: func() []byte { return buildResponse(disconnect, CoAACK, testSecret, nil, false) },
+			wantErr:  true,
+		},
+		{
+			name:     "truncated",
+			request:  disconnect,
+			response: func() []byte { return buildResponse(disconnect, DisconnectACK, testSecret, nil, false)[:10] },
+			wantErr:  true,
+		},
+		{
+			name:    "malformed attribute",
+			request: disconnect,
+			response: func() []byte {
+				return buildResponse(disconnect, DisconnectNAK, testSecret, []byte{errorCauseType, 9, 0, 0}, false)
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := DecodeDynamicResponse(test.response(), test.request, testSecret)
+			if test.wantErr {
+				if !errors.Is(err, InvalidResponseError) {
+					t.Fatalf("got error %v, want %v", err, InvalidResponseError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Acknowledged() != test.wantAcknowledged {
+				t.Fatalf("got acknowledged %v, want %v", response.Acknowledged(), test.wantAcknowledged)
+			}
+			if response.ErrorCause != test.wantCause {
+				t.Fatalf("got Error-Cause %d, want %d", response.ErrorCause, test.wantCause)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package radius
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MAC address formats
+const (
+	// ColonFormat is aa:bb:cc:dd:ee:ff, the canonical format
+	ColonFormat = "colon"
+	// HyphenFormat is aa-bb-cc-dd-ee-ff, as in RFC 3580 Calling-Station-Id
+	HyphenFormat = "hyphen"
+	// DotFormat is aabb.ccdd.eeff, as used by Cisco
+	DotFormat = "dot"
+	// BareFormat is aabbccddeeff
+	BareFormat = "bare"
+)
+
+// ParseMAC parses a 48 bits MAC address written with colons, hyphens, dots (Cisco) or without separator
+func ParseMAC(value string) (net.HardwareAddr, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 12 && !strings.ContainsAny(value, ":-.") {
+		parts := make([]string, 0, 6)
+		for i := 0; i < 12; i += 2 {
+			parts = append(parts, value[i:i+2])
+		}
+		value = strings.Join(parts, ":")
+	}
+	mac, err := net.ParseMAC(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%s is not a 48 bits MAC address", value)
+	}
+	return mac, nil
+}
+
+// NormalizeMAC returns the MAC address in lower case, colon separated form
+func NormalizeMAC(value string) (string, error) {
+	mac, err := ParseMAC(value)
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
+
+// FormatMAC returns the MAC address in one of the formats
+func FormatMAC(mac net.HardwareAddr, format string, uppercase bool) string {
+	hex := strings.ReplaceAll(mac.String(), ":", "")
+	var formatted string
+	switch format {
+	case HyphenFormat:
+		formatted = strings.ReplaceAll(mac.String(), ":", "-")
+	case DotFormat:
+		formatted = hex[0:4] + "." + hex[4:8] + "." + hex[8:12]
+	case BareFormat:
+		formatted = hex
+	default:
+		formatted = mac.String()
+	}
+	if uppercase {
+		return strings.ToUpper(formatted)
+	}
+	return formatted
+}
+
+// CanonicalMAC returns the MAC address in the canonical format, or the trimmed lower case value if it cannot be parsed
+func CanonicalMAC(value string) (string, bool) {
+	mac, err := NormalizeMAC(value)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(value)), false
+	}
+	return mac, true
+}
@@ -0,0 +1,87 @@
+package radius
+
+import (
+	"testing"
+)
+
+func TestParseMAC(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "aa:bb:cc:dd:ee:ff", want: "aa:bb:cc:dd:ee:ff"},
+		{value: "AA-BB-CC-DD-EE-FF", want: "aa:bb:cc:dd:ee:ff"},
+		{value: "aabb.ccdd.eeff", want: "aa:bb:cc:dd:ee:ff"},
+		{value: "AABBCCDDEEFF", want: "aa:bb:cc:dd:ee:ff"},
+		{value: " aabbccddeeff\n", want: "aa:bb:cc:dd:ee:ff"},
+		{value: "", wantErr: true},
+		{value: "aabbccddeef", wantErr: true},
+		{value: "aabbccddeegg", wantErr: true},
+		{value: "aa:bb:cc:dd:ee", wantErr: true},
+		// EUI-64 is not a 48 bits MAC address
+		{value: "aa:bb:cc:dd:ee:ff:00:11", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			mac, err := ParseMAC(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", mac)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mac.String() != test.want {
+				t.Fatalf("got %s, want %s", mac, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatMAC(t *testing.T) {
+	mac, err := ParseMAC("aa:bb:cc:dd:ee:0f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format    string
+		uppercase bool
+		want      string
+	}{
+		{format: ColonFormat, want: "aa:bb:cc:dd:ee:0f"},
+		{format: ColonFormat, uppercase: true, want: "AA:BB:CC:DD:EE:0F"},
+		{format: HyphenFormat, want: "aa-bb-cc-dd-ee-0f"},
+		{format: HyphenFormat, uppercase: true, want: "AA-BB-CC-DD-EE-0F"},
+		{format: DotFormat, want: "aabb.ccdd.ee0f"},
+		{format: BareFormat, want: "aabbccddee0f"},
+		{format: BareFormat, uppercase: true, want: "AABBCCDDEE0F"},
+		{format: "unknown", want: "aa:bb:cc:dd:ee:0f"},
+	}
+	for _, test := range tests {
+		if got := FormatMAC(mac, test.format, test.uppercase); got != test.want {
+			t.Errorf("format %s (uppercase %v): got %s, want %s", test.format, test.uppercase, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalMAC(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		wantValid bool
+	}{
+		{value: "AA-BB-CC-DD-EE-FF", want: "aa:bb:cc:dd:ee:ff", wantValid: true},
+		{value: "aabb.ccdd.eeff", want: "aa:bb:cc:dd:ee:ff", wantValid: true},
+		{value: " Not-A-MAC ", want: "not-a-mac"},
+		{value: "", want: ""},
+	}
+	for _, test := range tests {
+		got, valid := CanonicalMAC(test.value)
+		if got != test.want || valid != test.wantValid {
+			t.Errorf("%q: got %q (valid %v), want %q (valid %v)", test.value, got, valid, test.want, test.wantValid)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package radius
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"github.com/go-playground/validator/v10"
+	"net"
+	"strings"
+)
+
+const (
+	// StandardVendor sends the VLAN ID in Tunnel-Private-Group-Id
+	StandardVendor = "standard"
+	// NamedVendor sends the VLAN name in Tunnel-Private-Group-Id
+	NamedVendor = "named"
+	// ArubaVendor adds the role in Aruba-User-Role
+	ArubaVendor = "aruba"
+	// CiscoVendor adds the role in Cisco-AVPair
+	CiscoVendor = "cisco"
+	// UbiquitiVendor sends the VLAN name, as configured on the UniFi controller, in Tunnel-Private-Group-Id
+	UbiquitiVendor = "ubiquiti"
+)
+
+// VendorProfile translates a VLAN and role decision into the reply attributes expected by a NAS vendor
+type VendorProfile struct {
+	Name   string `yaml:"name"`
+	Vendor string `yaml:"vendor" default:"standard" validate:"oneof=standard named aruba cisco ubiquiti"`
+	// NAS IP addresses or networks using this profile
+	Networks []string `yaml:"networks" validate:"min=1,dive,cidrv4|ipv4"`
+	// VLAN names, for named and ubiquiti vendors
+	VlanNames map[uint16]string `yaml:"vlan_names"`
+	// Roles by VLAN, used when the authenticator does not give one
+	Roles map[uint16]string `yaml:"roles"`
+	// Override the attribute and format (with a %s for the role) used for the role
+	RoleAttribute string `yaml:"role_attribute"`
+	RoleFormat    string `yaml:"role_format"`
+	networks      []*net.IPNet
+}
+
+func (p *VendorProfile) Check() error {
+	if err := defaults.Set(p); err != nil {
+		return err
+	}
+	if err := validator.New().Struct(p); err != nil {
+		return fmt.Errorf("invalid vendor profile %s: %w", p.Name, err)
+	}
+	p.networks = nil
+	for _, network := range p.Networks {
+		if !strings.Contains(network, "/") {
+			network = network + "/32"
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return fmt.Errorf("invalid network %s in vendor profile %s: %w", network, p.Name, err)
+		}
+		p.networks = append(p.networks, ipNet)
+	}
+	if len(p.RoleAttribute) == 0 {
+		switch p.Vendor {
+		case ArubaVendor:
+			p.RoleAttribute = "Aruba-User-Role"
+		case CiscoVendor:
+			p.RoleAttribute = "Cisco-AVPair"
+			if len(p.RoleFormat) == 0 {
+				p.RoleFormat = "role=%s"
+			}
+		}
+	}
+	if len(p.RoleFormat) == 0 {
+		p.RoleFormat = "%s"
+	}
+	if strings.Count(p.RoleFormat, "%s") != 1 {
+		return fmt.Errorf("role format of vendor profile %s must contain exactly one %%s", p.Name)
+	}
+	return nil
+}
+
+// Match reports if the NAS IP uses this profile
+func (p *VendorProfile) Match(ip string) bool {
+	nas := net.ParseIP(ip)
+	if nas == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(nas) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the vendor reply attributes for a VLAN and role decision.
+// The VLAN tunnel attributes themselves are always sent, Tunnel-Private-Group-Id is replaced when needed.
+func (p *VendorProfile) Apply(vlanId uint16, role string) Attributes {
+	var attributes Attributes
+	switch p.Vendor {
+	case NamedVendor, UbiquitiVendor:
+		if name, ok := p.VlanNames[vlanId]; ok && vlanId > 0 {
+			attributes = append(attributes, Attribute{Name: "Tunnel-Private-Group-Id", Type: StringType, Value: name})
+		}
+	}
+	if len(role) == 0 {
+		role = p.Roles[vlanId]
+	}
+	if len(role) > 0 && len(p.RoleAttribute) > 0 {
+		attributes = append(attributes, Attribute{Name: p.RoleAttribute, Type: StringType, Value: fmt.Sprintf(p.RoleFormat, role)})
+	}
+	return attributes
+}
+
+// PskAttributes returns the reply attributes carrying a device PSK for the vendor, Tunnel-Password without profile
+func (p *VendorProfile) PskAttributes(psk string) Attributes {
+	vendor := StandardVendor
+	if p != nil {
+		vendor = p.Vendor
+	}
+	switch vendor {
+	case ArubaVendor:
+		return Attributes{{Name: "Aruba-MPSK-Passphrase", Type: StringType, Value: psk}}
+	case CiscoVendor:
+		return Attributes{
+			{Name: "Cisco-AVPair", Type: StringType, Value: "psk-mode=ascii"},
+			{Name: "Cisco-AVPair", Type: StringType, Value: "psk=" + psk},
+		}
+	default:
+		return Attributes{{Name: "Tunnel-Password", Type: StringType, Value: psk}}
+	}
+}
+
+// mergeKey identifies the value an attribute sets: its name, and the key of a vendor AVPair,
+// as these are repeated for each key=value pair
+func (a Attribute) mergeKey() string {
+	if a.Name == "Cisco-AVPair" {
+		if key, _, found := strings.Cut(a.Value, "="); found {
+			return a.Name + ":" + key
+		}
+	}
+	return a.Name
+}
+
+// Merge returns the attributes followed by the other ones not already set
+func (a Attributes) Merge(other Attributes) Attributes {
+	keys := make(map[string]bool, len(a))
+	for _, attribute := range a {
+		keys[attribute.mergeKey()] = true
+	}
+	merged := append(Attributes{}, a...)
+	for _, attribute := range other {
+		if !keys[attribute.mergeKey()] {
+			merged = append(merged, attribute)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,68 @@
+package radius
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream Attributes
+		profile  Attributes
+		want     Attributes
+	}{
+		{
+			name:     "upstream attribute kept",
+			upstream: Attributes{{Name: "Aruba-User-Role", Value: "staff"}},
+			profile:  Attributes{{Name: "Aruba-User-Role", Value: "guest"}},
+			want:     Attributes{{Name: "Aruba-User-Role", Value: "staff"}},
+		},
+		{
+			name:     "upstream AVPair and profile role",
+			upstream: Attributes{{Name: "Cisco-AVPair", Value: "url-redirect=https://portal"}},
+			profile:  Attributes{{Name: "Cisco-AVPair", Value: "role=staff"}},
+			want: Attributes{
+				{Name: "Cisco-AVPair", Value: "url-redirect=https://portal"},
+				{Name: "Cisco-AVPair", Value: "role=staff"},
+			},
+		},
+		{
+			name:     "upstream role AVPair kept",
+			upstream: Attributes{{Name: "Cisco-AVPair", Value: "role=admin"}, {Name: "Cisco-AVPair", Value: "url-redirect=https://portal"}},
+			profile:  Attributes{{Name: "Cisco-AVPair", Value: "role=staff"}},
+			want: Attributes{
+				{Name: "Cisco-AVPair", Value: "role=admin"},
+				{Name: "Cisco-AVPair", Value: "url-redirect=https://portal"},
+			},
+		},
+		{
+			name:    "profile only",
+			profile: Attributes{{Name: "Tunnel-Private-Group-Id", Value: "staff"}},
+			want:    Attributes{{Name: "Tunnel-Private-Group-Id", Value: "staff"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.upstream.Merge(test.profile); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyCisco(t *testing.T) {
+	profile := VendorProfile{Name: "cisco", Vendor: CiscoVendor, Networks: []string{"192.0.2.0/24"}}
+	if err := profile.Check(); err != nil {
+		t.Fatal(err)
+	}
+	upstream := Attributes{{Name: "Cisco-AVPair", Type: StringType, Value: "url-redirect=https://portal"}}
+	got := upstream.Merge(profile.Apply(10, "staff"))
+	want := Attributes{
+		{Name: "Cisco-AVPair", Type: StringType, Value: "url-redirect=https://portal"},
+		{Name: "Cisco-AVPair", Type: StringType, Value: "role=staff"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
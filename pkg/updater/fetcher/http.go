@@ -1,6 +1,7 @@
 package fetcher
 
 import (
+	"context"
 	"github.com/COSAE-FR/ripradius/pkg/local/client"
 	"github.com/COSAE-FR/ripradius/pkg/updater/binding"
 )
@@ -10,7 +11,7 @@ type HttpFetcher struct {
 }
 
 func (f *HttpFetcher) GetRemoteCertificate() (*binding.RadiusCertificate, error) {
-	return f.client.GetCertificate()
+	return f.client.GetCertificate(context.Background())
 }
 
 func NewHttpFetcher(client *client.Client) *HttpFetcher {
@@ -6,11 +6,13 @@ import (
 	"encoding/pem"
 	"fmt"
 	"github.com/COSAE-FR/ripradius/pkg/freeradius"
+	"github.com/COSAE-FR/ripradius/pkg/pki"
 	"github.com/COSAE-FR/ripradius/pkg/updater/binding"
 	"github.com/COSAE-FR/riputils/common"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func (s *Server) update() {
@@ -23,6 +25,11 @@ func (s *Server) fetchUpdate() {
 
 func (s *Server) applyUpdate() error {
 	cert, err := s.getRemoteCertificate()
+	if err == nil {
+		if _, err = pki.ValidateServerCertificate(cert.Certificate, cert.CA, time.Now()); err != nil {
+			s.log.Errorf("invalid remote certificate: %s", err)
+		}
+	}
 	if err != nil {
 		cert, err = s.getLocalCertificate()
 		if err != nil {
@@ -37,6 +44,9 @@ func (s *Server) applyUpdate() error {
 	cfg.CA = cert.CA
 	cfg.Certificate = cert.Certificate
 	cfg.Key = cert.Key
+	if info, err := pki.DescribeCertificate(cfg.Certificate); err == nil {
+		cfg.CertificateInfo = info
+	}
 	return s.configureAndStartRadius(&cfg)
 }
 
@@ -49,6 +59,9 @@ func (s *Server) startWithoutRemote() error{
 	cfg.CA = cert.CA
 	cfg.Certificate = cert.Certificate
 	cfg.Key = cert.Key
+	if info, err := pki.DescribeCertificate(cfg.Certificate); err == nil {
+		cfg.CertificateInfo = info
+	}
 	return s.configureAndStartRadius(&cfg)
 }
 
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github.com/COSAE-FR/ripradius/pkg/api/local"
 	"github.com/COSAE-FR/ripradius/pkg/freeradius"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
 	"github.com/COSAE-FR/ripradius/pkg/local/cache"
 	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/local/coa"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
 	"github.com/COSAE-FR/ripradius/pkg/local/token"
 	"github.com/COSAE-FR/ripradius/pkg/updater"
 	"github.com/COSAE-FR/ripradius/pkg/utils"
@@ -15,6 +19,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 type Configuration struct {
@@ -22,6 +27,10 @@ type Configuration struct {
 	Cache           cache.Configuration      `yaml:"cache"`
 	Api             local.Configuration      `yaml:"api"`
 	Client          client.Configuration     `yaml:"client"`
+	Health          health.Configuration     `yaml:"health"`
+	Sessions        session.Configuration    `yaml:"sessions"`
+	CoA             coa.Configuration        `yaml:"coa"`
+	Audit           audit.Configuration      `yaml:"audit"`
 	Radius          freeradius.Configuration `yaml:"radius"`
 	Fetcher         *updater.Configuration   `yaml:"fetcher,omitempty"`
 	Log             *logrus.Entry            `yaml:"-"`
@@ -48,7 +57,13 @@ func (c *Configuration) Check() error {
 	if err := c.Radius.Check(); err != nil {
 		return err
 	}
-	if c.Client.Token == "" {
+	if len(c.Cache.KeyFile) == 0 {
+		c.Cache.Secret = c.Radius.Secret
+	}
+	if c.Client.SigningSecret == "" {
+		c.Client.SigningSecret = c.Radius.Secret
+	}
+	if c.Client.Auth != client.HMACAuth && c.Client.Token == "" && c.Client.TokenFile == "" {
 		clientToken, err := token.ComputeToken(c.Radius.Secret)
 		if err != nil {
 			return err
@@ -58,6 +73,32 @@ func (c *Configuration) Check() error {
 	if err := c.Client.Check(); err != nil {
 		return err
 	}
+	callDuration := c.Client.MaxCallDuration()
+	if c.Radius.RestTimeout == 0 {
+		c.Radius.RestTimeout = callDuration + time.Second
+	}
+	if callDuration >= c.Radius.RestTimeout {
+		return fmt.Errorf("authenticator calls can last %s, more than the Freeradius rest timeout %s: lower client timeout or retries", callDuration, c.Radius.RestTimeout)
+	}
+	maxRequestTime := time.Duration(c.Radius.MaxRequestTime) * time.Second
+	if c.Radius.RestTimeout >= maxRequestTime {
+		return fmt.Errorf("the Freeradius rest timeout %s must be less than its max request time %s: lower client timeout or retries", c.Radius.RestTimeout, maxRequestTime)
+	}
+	if err := c.Health.Check(); err != nil {
+		return err
+	}
+	if err := c.Sessions.Check(); err != nil {
+		return err
+	}
+	if c.CoA.Secret == "" {
+		c.CoA.Secret = c.Radius.Secret
+	}
+	if err := c.CoA.Check(); err != nil {
+		return err
+	}
+	if err := c.Audit.Check(); err != nil {
+		return err
+	}
 	if c.Fetcher != nil {
 		if err := c.Fetcher.Check(); err != nil {
 			return err
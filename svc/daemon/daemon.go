@@ -2,6 +2,11 @@ package daemon
 
 import (
 	"github.com/COSAE-FR/ripradius/pkg/api/local"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
+	"github.com/COSAE-FR/ripradius/pkg/local/cache"
+	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
 	"github.com/COSAE-FR/riputils/svc"
 	"github.com/sirupsen/logrus"
 )
@@ -10,10 +15,39 @@ type Daemon struct {
 	Configuration *Configuration
 	Freeradius    svc.Configurable
 	Api           *local.Server
+	Cache         *cache.Cache
+	Client        *client.Client
+	Health        *health.Monitor
+	Sessions      *session.Store
+	Audit         *audit.Log
 	Log           *logrus.Entry
 }
 
 func (d *Daemon) Start() error {
+	if d.Cache != nil {
+		d.Log.Debug("Starting cache")
+		if err := d.Cache.Start(); err != nil {
+			return err
+		}
+	}
+	if d.Client != nil {
+		d.Log.Debug("Starting authenticator credentials watcher")
+		if err := d.Client.Start(); err != nil {
+			return err
+		}
+	}
+	if d.Health != nil {
+		d.Log.Debug("Starting upstream health monitor")
+		if err := d.Health.Start(); err != nil {
+			return err
+		}
+	}
+	if d.Sessions != nil {
+		d.Log.Debug("Starting session store")
+		if err := d.Sessions.Start(); err != nil {
+			return err
+		}
+	}
 	d.Log.Debug("Starting API server")
 	if err := d.Api.Start(); err != nil {
 		return err
@@ -37,6 +71,36 @@ func (d *Daemon) Stop() error {
 	}
 	d.Log.Debug("Stopping API server")
 	err := d.Api.Stop()
+	if d.Audit != nil {
+		d.Log.Debug("Closing audit log")
+		if e := d.Audit.Stop(); e != nil {
+			d.Log.Errorf("Error while closing audit log: %s", e)
+		}
+	}
+	if d.Sessions != nil {
+		d.Log.Debug("Stopping session store")
+		if e := d.Sessions.Stop(); e != nil {
+			d.Log.Errorf("Error while stopping session store: %s", e)
+		}
+	}
+	if d.Health != nil {
+		d.Log.Debug("Stopping upstream health monitor")
+		if e := d.Health.Stop(); e != nil {
+			d.Log.Errorf("Error while stopping upstream health monitor: %s", e)
+		}
+	}
+	if d.Client != nil {
+		d.Log.Debug("Stopping authenticator credentials watcher")
+		if e := d.Client.Stop(); e != nil {
+			d.Log.Errorf("Error while stopping authenticator credentials watcher: %s", e)
+		}
+	}
+	if d.Cache != nil {
+		d.Log.Debug("Stopping cache")
+		if e := d.Cache.Stop(); e != nil {
+			d.Log.Errorf("Error while stopping cache: %s", e)
+		}
+	}
 	d.Log.Trace("Services stopped")
 	return err
 }
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/COSAE-FR/ripradius/pkg/api/binding"
 	"github.com/COSAE-FR/ripradius/pkg/api/local"
 	"github.com/COSAE-FR/ripradius/pkg/freeradius"
+	"github.com/COSAE-FR/ripradius/pkg/local/audit"
 	"github.com/COSAE-FR/ripradius/pkg/local/cache"
 	"github.com/COSAE-FR/ripradius/pkg/local/client"
+	"github.com/COSAE-FR/ripradius/pkg/local/coa"
+	"github.com/COSAE-FR/ripradius/pkg/local/events"
+	"github.com/COSAE-FR/ripradius/pkg/local/health"
+	"github.com/COSAE-FR/ripradius/pkg/local/session"
 	"github.com/COSAE-FR/ripradius/pkg/updater"
 	"github.com/COSAE-FR/ripradius/pkg/utils"
 	"github.com/COSAE-FR/ripradius/svc/daemon"
@@ -25,6 +34,7 @@ func New(logger *log.Entry, cfg shared.Config) (svc.Daemonizer, error) {
 		logger.Errorf("Cannot create authentication API client: %s", err)
 		return nil, err
 	}
+	dmn.Client = clt
 	if &config.Radius != nil {
 		logger.Debug("Freeradius configuration found, configuring")
 		if config.Fetcher != nil {
@@ -51,11 +61,81 @@ func New(logger *log.Entry, cfg shared.Config) (svc.Daemonizer, error) {
 		logger.Errorf("Cannot create user cache: %s", err)
 		return nil, err
 	}
-	srv, err := local.New(logger, &config.Api, userCache, clt)
+	dmn.Cache = userCache
+	bus := events.New(config.Api.EventBuffer)
+	userCache.SetNotifier(func(action string, username string, mac string) {
+		message := "Cache entry " + action
+		if action == cache.FlushedAction {
+			message = "Cache flushed"
+		}
+		bus.Publish(events.Event{
+			Type:     events.CacheEvent,
+			Username: username,
+			Mac:      mac,
+			Message:  message,
+			Data:     map[string]interface{}{"action": action},
+		})
+	})
+	monitor := health.New(logger, &config.Health, func() error {
+		_, err := clt.GetStatus(context.Background())
+		return err
+	})
+	monitor.OnChange(func(from health.State, to health.State) {
+		switch to {
+		case health.Offline:
+			userCache.SetOffline()
+		case health.Online:
+			userCache.SetOnline()
+		}
+		bus.Publish(events.Event{
+			Type:    events.UpstreamEvent,
+			Message: fmt.Sprintf("Authenticator %s, was %s", to, from),
+			Data:    map[string]interface{}{"from": from, "to": to},
+		})
+	})
+	dmn.Health = monitor
+	sessions, err := session.New(logger, &config.Sessions)
+	if err != nil {
+		logger.Errorf("Cannot create session store: %s", err)
+		return nil, err
+	}
+	sessions.SetForwarder(func(ctx context.Context, records []session.Record) error {
+		if monitor.State() == health.Offline {
+			return errors.New("authenticator offline")
+		}
+		return clt.PostAccounting(ctx, records)
+	})
+	dmn.Sessions = sessions
+	srv, err := local.New(logger, &config.Api, userCache, clt, monitor, sessions)
 	if err != nil {
 		logger.Errorf("Cannot create API service: %s", err)
 		return nil, err
 	}
+	sender, err := coa.New(logger, &config.CoA)
+	if err != nil {
+		logger.Errorf("Cannot create dynamic authorization sender: %s", err)
+		return nil, err
+	}
+	sender.SetSecretLookup(func(ip string) (string, bool) {
+		// A stale client may have changed its secret, or be gone from the authenticator
+		nas, mustRefresh, found := userCache.GetClientWithRefreshNeed(ip)
+		return nas.Secret, found && !mustRefresh
+	})
+	srv.SetCoASender(sender)
+	srv.SetEventBus(bus)
+	auditLog, err := audit.New(logger, &config.Audit)
+	if err != nil {
+		logger.Errorf("Cannot create audit log: %s", err)
+		return nil, err
+	}
+	srv.SetAuditLog(auditLog)
+	dmn.Audit = auditLog
+	srv.SetCertificateStatus(func() *binding.CertificateStatus {
+		if config.Fetcher != nil && config.Fetcher.Radius != nil {
+			return config.Fetcher.Radius.CertificateStatus()
+		}
+		return config.Radius.CertificateStatus()
+	})
 	dmn.Api = srv
 	return &dmn, nil
 }